@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func runChain(ctx context.Context, args []string) error {
+	fs := newFlagSet("chain", i18n.T("-old 旧文件夹路径 -new 新文件夹路径 -diff 差异文件夹路径1 -diff 差异文件夹路径2 ... [选项]"))
+	oldFlag := fs.String("old", "", i18n.T("旧版文件夹路径"))
+	newFlag := fs.String("new", "", i18n.T("新版文件夹路径，不存在则会自动创建"))
+	var diffFlag stringsFlag
+	fs.Var(&diffFlag, "diff", i18n.T("差异文件夹路径或 HTTP 地址，按应用顺序重复指定，如 1→2、2→3、3→4"))
+	symlinkPolicyFlag := fs.String("symlink-policy", string(patch.SymlinkPolicyAllow), i18n.T("指向新版文件夹之外的符号链接的处理方式：allow、skip 或 error"))
+	copyModeFlag := fs.String("copy-mode", string(patch.CopyModeCopy), i18n.T("copy 操作生成新版文件的方式：copy、hardlink 或 reflink，hardlink 和 reflink 失败时复制"))
+	sourceFlags := addSourceFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	oldDirAbsPath, err := getDirArg("old", *oldFlag, true)
+	if err != nil {
+		return err
+	}
+	newDirAbsPath, err := getDirArg("new", *newFlag, false)
+	if err != nil {
+		return err
+	}
+	if err := patch.CheckDirs(oldDirAbsPath, newDirAbsPath); err != nil {
+		return newOptionError(err.Error())
+	}
+	sources, err := sourceFlags.sources("diff", diffFlag)
+	if err != nil {
+		return err
+	}
+	symlinkPolicy, err := getSymlinkPolicy(*symlinkPolicyFlag)
+	if err != nil {
+		return err
+	}
+	copyMode, err := getCopyMode(*copyModeFlag)
+	if err != nil {
+		return err
+	}
+	log.Println(i18n.T("旧版文件夹："), oldDirAbsPath)
+	log.Println(i18n.T("新版文件夹："), newDirAbsPath)
+	if err := patch.ApplyChainSources(ctx, oldDirAbsPath, newDirAbsPath, sources, &patch.ApplyOptions{
+		SymlinkPolicy: symlinkPolicy,
+		CopyMode:      copyMode,
+	}); err != nil {
+		return err
+	}
+	log.Println(i18n.T("全部补丁应用成功"))
+	return nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"runtime"
+
+	"github.com/ganlvtech/go-dir-bsdiff/diff"
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+const (
+	DefaultBulkSize = 100 * 1024 * 1024
+	// MaxBulkSize 是分块大小的上限，bsdiff 使用 int32 下标
+	MaxBulkSize = math.MaxInt32 - 1
+)
+
+type diffFlags struct {
+	old, new, out string
+	reverse       string
+	bulkSize      sizeFlag
+	memoryBudget  sizeFlag
+	symlinkPolicy string
+	ignoreFile    string
+	hashCache     string
+	workers       int
+	base          stringsFlag
+	exclude       stringsFlag
+	include       stringsFlag
+	optionFlags   *diffOptionFlags
+}
+
+// getBaseDirs 返回 -old 和全部 -base 指定的旧版文件夹，每个旧版文件夹的名称不能重复
+func getBaseDirs(oldDirAbsPath string, baseDirs []string) ([]string, error) {
+	baseDirAbsPaths := []string{oldDirAbsPath}
+	names := map[string]bool{filepath.Base(oldDirAbsPath): true}
+	for _, baseDir := range baseDirs {
+		baseDirAbsPath, err := getDirArg("base", baseDir, true)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(baseDirAbsPath)
+		if names[name] {
+			return nil, newOptionError(fmt.Sprintf(i18n.T("旧版文件夹名称 %s 重复"), name))
+		}
+		names[name] = true
+		baseDirAbsPaths = append(baseDirAbsPaths, baseDirAbsPath)
+	}
+	if len(baseDirAbsPaths) > 1 && names[diff.PayloadStoreDirName] {
+		return nil, newOptionError(fmt.Sprintf(i18n.T("旧版文件夹名称不能是 %s"), diff.PayloadStoreDirName))
+	}
+	return baseDirAbsPaths, nil
+}
+
+func (f *diffFlags) ignoreRules(dirAbsPaths ...string) (*util.IgnoreRules, error) {
+	ignoreRules := util.NewIgnoreRules()
+	for _, dirAbsPath := range dirAbsPaths {
+		if err := ignoreRules.AddExcludeFileIfExists(dirAbsPath); err != nil {
+			return nil, err
+		}
+	}
+	if f.ignoreFile != "" {
+		if err := ignoreRules.AddExcludeFile(f.ignoreFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range f.exclude {
+		ignoreRules.AddExclude(pattern)
+	}
+	for _, pattern := range f.include {
+		ignoreRules.AddInclude(pattern)
+	}
+	return ignoreRules, nil
+}
+
+func runDiff(ctx context.Context, args []string) error {
+	fs := newFlagSet("diff", i18n.T("-old 旧文件夹路径 -new 新文件夹路径 -out 差异文件夹路径 [选项]"))
+	f := &diffFlags{bulkSize: DefaultBulkSize}
+	fs.StringVar(&f.old, "old", "", i18n.T("旧版文件夹路径"))
+	fs.StringVar(&f.new, "new", "", i18n.T("新版文件夹路径"))
+	fs.StringVar(&f.out, "out", "", i18n.T("输出差异文件夹路径，不存在则会自动创建"))
+	fs.Var(&f.bulkSize, "bulk-size", i18n.T("文件分块大小，如 64MiB、1GiB"))
+	fs.Var(&f.memoryBudget, "memory-budget", i18n.T("应用补丁的机器的内存预算，如 1GiB，指定后按内存预算为每个文件选择分块大小：不超过最大分块大小的文件不分块，更大的文件平均分块，不能与 -bulk-size 同时使用"))
+	fs.StringVar(&f.reverse, "reverse", "", i18n.T("同时生成从新版还原到旧版的反向补丁的差异文件夹路径，复用同一次扫描结果，用于回滚"))
+	fs.Var(&f.base, "base", i18n.T("额外的旧版文件夹，可以重复指定，为 -old 和每个 -base 各生成一个补丁，放在差异文件夹中以旧版文件夹名称命名的子文件夹中，差异文件按内容去重保存在 payloads 子文件夹中"))
+	fs.StringVar(&f.symlinkPolicy, "symlink-policy", string(patch.SymlinkPolicyAllow), i18n.T("指向新版文件夹之外的符号链接的处理方式：allow、skip 或 error"))
+	fs.Var(&f.exclude, "exclude", i18n.T("gitignore 风格的排除规则，可以重复指定"))
+	fs.Var(&f.include, "include", i18n.T("gitignore 风格的包含规则，可以重复指定，指定后只扫描匹配的文件"))
+	fs.StringVar(&f.ignoreFile, "ignore-file", "", i18n.T("gitignore 格式的排除规则文件，旧版和新版文件夹根目录下的 .bsdiffignore 文件会被自动读取"))
+	fs.StringVar(&f.hashCache, "hash-cache", "", i18n.T("MD5 缓存文件，文件大小、修改时间、inode 都未改变的文件直接使用缓存的 MD5"))
+	fs.IntVar(&f.workers, "workers", runtime.NumCPU(), i18n.T("同时计算 MD5 的协程数量，旧版和新版文件夹共用"))
+	f.optionFlags = addDiffOptionFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	oldDirAbsPath, err := getDirArg("old", f.old, true)
+	if err != nil {
+		return err
+	}
+	newDirAbsPath, err := getDirArg("new", f.new, true)
+	if err != nil {
+		return err
+	}
+	diffDirAbsPath, err := getDirArg("out", f.out, false)
+	if err != nil {
+		return err
+	}
+	if f.bulkSize <= 0 || f.bulkSize > MaxBulkSize {
+		return newOptionError(fmt.Sprintf(i18n.T("-bulk-size %s 超出范围，必须大于 0 且不超过 %s"), f.bulkSize.String(), util.FormatSize(MaxBulkSize)))
+	}
+	bulkSize := int(f.bulkSize)
+	if f.workers < 1 {
+		return newOptionError(fmt.Sprintf(i18n.T("-workers %d 必须大于 0"), f.workers))
+	}
+	symlinkPolicy, err := getSymlinkPolicy(f.symlinkPolicy)
+	if err != nil {
+		return err
+	}
+	diffOptions, err := f.optionFlags.options()
+	if err != nil {
+		return err
+	}
+	if f.memoryBudget < 0 {
+		return newOptionError(i18n.T("-memory-budget 不能是负数"))
+	}
+	if f.memoryBudget > 0 {
+		bulkSizeSet := false
+		fs.Visit(func(fl *flag.Flag) {
+			bulkSizeSet = bulkSizeSet || fl.Name == "bulk-size"
+		})
+		if bulkSizeSet {
+			return newOptionError(i18n.T("-bulk-size 不能与 -memory-budget 同时使用"))
+		}
+		maxBulkSize := int64(f.memoryBudget) / diff.PatchMemoryFactor
+		if maxBulkSize <= 0 {
+			return newOptionError(fmt.Sprintf(i18n.T("-memory-budget %s 太小"), f.memoryBudget.String()))
+		}
+		bulkSize = int(min(maxBulkSize, MaxBulkSize))
+		diffOptions.AdaptiveChunks = true
+		log.Printf(i18n.T("按内存预算 %s 选择分块大小，最大分块大小：%s"), f.memoryBudget.String(), util.FormatSize(int64(bulkSize)))
+	}
+	baseDirAbsPaths, err := getBaseDirs(oldDirAbsPath, f.base)
+	if err != nil {
+		return err
+	}
+	multiBase := len(baseDirAbsPaths) > 1
+	if multiBase && f.reverse != "" {
+		return newOptionError(i18n.T("-reverse 不能与 -base 同时使用"))
+	}
+	reverseDirAbsPath := ""
+	if f.reverse != "" {
+		reverseDirAbsPath, err = getDirArg("reverse", f.reverse, false)
+		if err != nil {
+			return err
+		}
+		if reverseDirAbsPath == diffDirAbsPath {
+			return newOptionError(i18n.T("反向差异文件夹不能与输出差异文件夹相同"))
+		}
+	}
+
+	for _, baseDirAbsPath := range baseDirAbsPaths {
+		log.Println(i18n.T("旧版文件夹："), baseDirAbsPath)
+	}
+	log.Println(i18n.T("新版文件夹："), newDirAbsPath)
+	log.Println(i18n.T("输出差异文件夹："), diffDirAbsPath)
+	if err := mkdirOutput(diffDirAbsPath); err != nil {
+		return err
+	}
+	if reverseDirAbsPath != "" {
+		log.Println(i18n.T("反向差异文件夹："), reverseDirAbsPath)
+		if err := mkdirOutput(reverseDirAbsPath); err != nil {
+			return err
+		}
+	}
+
+	ignoreRules, err := f.ignoreRules(append(baseDirAbsPaths, newDirAbsPath)...)
+	if err != nil {
+		return fmt.Errorf(i18n.T("读取排除规则错误：%w"), err)
+	}
+	scanOptions := &util.ScanOptions{Ignore: ignoreRules, Workers: f.workers}
+	if f.hashCache != "" {
+		scanOptions.Cache, err = util.LoadHashCache(f.hashCache)
+		if err != nil {
+			return fmt.Errorf(i18n.T("读取 MD5 缓存错误：%w"), err)
+		}
+	}
+
+	log.Println()
+	log.Println(i18n.T("正在扫描旧版和新版文件夹全部文件"))
+	scans, err := util.ScanDirs(ctx, append(baseDirAbsPaths, newDirAbsPath), scanOptions)
+	if err != nil {
+		return fmt.Errorf(i18n.T("扫描文件夹错误：%w"), err)
+	}
+	oldScan, newScan := scans[0], scans[len(scans)-1]
+
+	if scanOptions.Cache != nil {
+		hits, misses := scanOptions.Cache.Stats()
+		log.Printf(i18n.T("MD5 缓存命中 %d 个文件，重新计算 %d 个文件"), hits, misses)
+		if err := scanOptions.Cache.Save(); err != nil {
+			return fmt.Errorf(i18n.T("保存 MD5 缓存错误：%w"), err)
+		}
+	}
+
+	if multiBase {
+		store, err := diff.NewPayloadStore(filepath.Join(diffDirAbsPath, diff.PayloadStoreDirName))
+		if err != nil {
+			return fmt.Errorf(i18n.T("创建差异文件存储失败：%w"), err)
+		}
+		for i, baseDirAbsPath := range baseDirAbsPaths {
+			baseDiffDirAbsPath := filepath.Join(diffDirAbsPath, filepath.Base(baseDirAbsPath))
+			log.Println()
+			log.Println(i18n.T("正在生成补丁："), baseDirAbsPath, "->", baseDiffDirAbsPath)
+			if err := mkdirOutput(baseDiffDirAbsPath); err != nil {
+				return err
+			}
+			if err := diff.Generate(ctx, diffOptions, baseDirAbsPath, newDirAbsPath, baseDiffDirAbsPath, scans[i], newScan, bulkSize, symlinkPolicy, store); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := diff.Generate(ctx, diffOptions, oldDirAbsPath, newDirAbsPath, diffDirAbsPath, oldScan, newScan, bulkSize, symlinkPolicy, nil); err != nil {
+		return err
+	}
+	if reverseDirAbsPath != "" {
+		log.Println()
+		log.Println(i18n.T("正在生成反向补丁："), reverseDirAbsPath)
+		if err := diff.Generate(ctx, diffOptions, newDirAbsPath, oldDirAbsPath, reverseDirAbsPath, newScan, oldScan, bulkSize, symlinkPolicy, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
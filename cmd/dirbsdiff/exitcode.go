@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+// 退出码，脚本可以根据退出码区分错误原因
+const (
+	ExitOK              = 0
+	ExitError           = 1  // 其他错误
+	ExitUsage           = 2  // 选项错误
+	ExitOldHashMismatch = 3  // 旧版文件不存在或 md5 不正确，旧版文件夹不能应用这个补丁
+	ExitPayloadMissing  = 4  // 差异文件不存在
+	ExitCorruptDelta    = 5  // 差异文件已损坏
+	ExitNewHashMismatch = 6  // 新版文件 md5 不正确
+	ExitInvalidManifest = 7  // 补丁描述文件不存在或无效
+	ExitChainMismatch   = 8  // 补丁不能连续应用
+	ExitNoSpace         = 9  // 磁盘空间不足
+	ExitPermission      = 10 // 没有权限
+	ExitCanceled        = 11 // 超时或收到中断信号
+)
+
+// optionError 是选项的值不正确的错误，退出码与选项解析错误相同
+type optionError struct {
+	message string
+}
+
+func (e *optionError) Error() string {
+	return e.message
+}
+
+func newOptionError(message string) error {
+	return &optionError{message: message}
+}
+
+// exitCode 返回错误对应的退出码
+func exitCode(err error) int {
+	var optErr *optionError
+	switch {
+	case err == nil:
+		return ExitOK
+	case err == errUsage || errors.As(err, &optErr):
+		return ExitUsage
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return ExitCanceled
+	case errors.Is(err, patch.ErrOldHashMismatch):
+		return ExitOldHashMismatch
+	case errors.Is(err, patch.ErrPayloadMissing):
+		return ExitPayloadMissing
+	case errors.Is(err, patch.ErrCorruptDelta):
+		return ExitCorruptDelta
+	case errors.Is(err, patch.ErrNewHashMismatch):
+		return ExitNewHashMismatch
+	case errors.Is(err, patch.ErrInvalidManifest):
+		return ExitInvalidManifest
+	case errors.Is(err, patch.ErrChainMismatch):
+		return ExitChainMismatch
+	case errors.Is(err, syscall.ENOSPC):
+		return ExitNoSpace
+	case errors.Is(err, os.ErrPermission):
+		return ExitPermission
+	}
+	return ExitError
+}
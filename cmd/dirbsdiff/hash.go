@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+func runHash(ctx context.Context, args []string) error {
+	fs := newFlagSet("hash", i18n.T("-dir 文件夹路径 [选项]"))
+	dirFlag := fs.String("dir", "", i18n.T("文件夹路径"))
+	f := &diffFlags{}
+	fs.Var(&f.exclude, "exclude", i18n.T("gitignore 风格的排除规则，可以重复指定"))
+	fs.Var(&f.include, "include", i18n.T("gitignore 风格的包含规则，可以重复指定，指定后只扫描匹配的文件"))
+	fs.StringVar(&f.ignoreFile, "ignore-file", "", i18n.T("gitignore 格式的排除规则文件，文件夹根目录下的 .bsdiffignore 文件会被自动读取"))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	dirAbsPath, err := getDirArg("dir", *dirFlag, true)
+	if err != nil {
+		return err
+	}
+	ignoreRules, err := f.ignoreRules(dirAbsPath)
+	if err != nil {
+		return fmt.Errorf(i18n.T("读取排除规则错误：%w"), err)
+	}
+	scan, err := util.ScanDir(ctx, dirAbsPath, &util.ScanOptions{Ignore: ignoreRules})
+	if err != nil {
+		return fmt.Errorf(i18n.T("扫描文件夹错误：%w"), err)
+	}
+	fmt.Println(util.TreeMD5(scan.Files))
+	return nil
+}
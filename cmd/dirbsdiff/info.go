@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+func formatRatio(newSize int64, ratio float64) string {
+	if newSize <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", ratio*100)
+}
+
+func printInfoTable(info *patch.Info) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("文件\t操作\t新版文件大小\t差异文件大小\t比例"))
+	for _, file := range info.Files {
+		operation := file.Operation
+		if len(file.Parts) > 0 {
+			operation = fmt.Sprintf(i18n.T("分 %d 块"), len(file.Parts))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", file.Name, operation, util.FormatSize(file.NewSize), util.FormatSize(file.PayloadSize), formatRatio(file.NewSize, file.Ratio))
+		for _, part := range file.Parts {
+			fmt.Fprintf(w, i18n.T("  第 %d 块\t%s\t\t%s\t\n"), part.Index, part.Operation, util.FormatSize(part.PayloadSize))
+		}
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, i18n.T("操作\t数量\t差异文件大小"))
+	for _, total := range info.Totals {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", total.Operation, total.Count, util.FormatSize(total.PayloadSize))
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println(i18n.T("补丁描述文件版本："), info.ManifestVersion)
+	fmt.Println(i18n.T("分块大小："), util.FormatSize(int64(info.BulkSize)))
+	if info.OldHash != "" {
+		fmt.Println(i18n.T("旧版版本哈希："), info.OldHash)
+		fmt.Println(i18n.T("新版版本哈希："), info.NewHash)
+	}
+	fmt.Println(i18n.T("文件数量："), len(info.Files))
+	fmt.Println(i18n.T("符号链接数量："), info.Symlinks)
+	fmt.Printf(i18n.T("文件夹数量：%d，删除文件夹数量：%d\n"), info.Dirs, info.RemovedDirs)
+	fmt.Println(i18n.T("新版文件总大小："), util.FormatSize(info.NewSize))
+	fmt.Println(i18n.T("差异文件总大小："), util.FormatSize(info.PayloadSize))
+	fmt.Println(i18n.T("比例："), formatRatio(info.NewSize, info.Ratio))
+}
+
+func runInfo(ctx context.Context, args []string) error {
+	fs := newFlagSet("info", i18n.T("-diff 差异文件夹路径 [选项]"))
+	diffFlag := fs.String("diff", "", i18n.T("差异文件夹路径"))
+	jsonFlag := fs.Bool("json", false, i18n.T("以 JSON 格式输出"))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	diffDirAbsPath, err := getDirArg("diff", *diffFlag, true)
+	if err != nil {
+		return err
+	}
+	manifest, err := patch.ReadManifest(diffDirAbsPath)
+	if err != nil {
+		return fmt.Errorf(i18n.T("读取补丁描述文件错误：%w"), err)
+	}
+	info, err := patch.Inspect(manifest, diffDirAbsPath)
+	if err != nil {
+		return err
+	}
+	if *jsonFlag {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+	printInfoTable(info)
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+const (
+	HelpTemplate = "使用方法：\n\n" +
+		"    dirbsdiff [-lang zh|en] [-timeout 时长] <子命令> [选项]\n\n" +
+		"界面语言默认按 LC_ALL、LC_MESSAGES、LANG 环境变量选择，也可以用 -lang 指定\n" +
+		"-timeout 指定最长运行时间，如 30m，超时或收到中断信号时停止并删除未完成的文件\n\n" +
+		"子命令：\n\n" +
+		"    diff    计算旧版和新版文件夹的差异，生成补丁\n" +
+		"    patch   应用补丁，把旧版文件夹更新到新版文件夹\n" +
+		"    verify  检查文件夹能否应用补丁，或者是否与补丁生成的结果一致\n" +
+		"    info    查看补丁中每个文件的操作和差异文件大小\n" +
+		"    chain   依次应用多个补丁\n" +
+		"    squash  把依次应用的多个补丁合并为一个补丁\n" +
+		"    serve   通过 HTTP 提供补丁，查询从某个版本更新到最新版本需要的补丁\n" +
+		"    hash    计算文件夹的版本哈希\n\n" +
+		"使用 dirbsdiff <子命令> -h 查看子命令的选项\n\n" +
+		"使用到的开源软件：\n\n" +
+		"    Pure Go bsdiff and bspatch libraries and CLI tools.\n" +
+		"        https://github.com/gabstv/go-bsdiff\n\n" +
+		"本程序使用 Go 语言开发，由 %s 生成\n"
+)
+
+// help 返回当前界面语言的使用方法
+func help() string {
+	return fmt.Sprintf(i18n.T(HelpTemplate), runtime.Version())
+}
+
+// errUsage 表示选项解析失败，flag 包已经输出了错误和使用方法
+var errUsage = errors.New("选项错误")
+
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"diff":   runDiff,
+	"patch":  runPatch,
+	"verify": runVerify,
+	"info":   runInfo,
+	"chain":  runChain,
+	"squash": runSquash,
+	"serve":  runServe,
+	"hash":   runHash,
+}
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// sizeFlag 是可以带单位的字节数，如 64MiB
+type sizeFlag int64
+
+func (s *sizeFlag) String() string {
+	return util.FormatSize(int64(*s))
+}
+
+func (s *sizeFlag) Set(value string) error {
+	size, err := util.ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = sizeFlag(size)
+	return nil
+}
+
+// newFlagSet 创建子命令的选项，usage 是子命令的使用方法
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), i18n.T("使用方法：\n\n    dirbsdiff %s %s\n\n选项：\n\n"), name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags 解析子命令的选项，不接受选项之外的参数
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return err
+	} else if err != nil {
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		return newOptionError(fmt.Sprintf(i18n.T("多余的参数：%s，路径等参数都需要用选项指定，使用 dirbsdiff %s -h 查看选项"), strings.Join(fs.Args(), " "), fs.Name()))
+	}
+	return nil
+}
+
+// getDirArg 检查选项 -name 指定的文件夹并返回绝对路径，mustExist 为 false 时允许文件夹不存在
+func getDirArg(name, dir string, mustExist bool) (string, error) {
+	if dir == "" {
+		return "", newOptionError(fmt.Sprintf(i18n.T("缺少 -%s 选项"), name))
+	}
+	if fileInfo, err := util.GetFileInfo(dir); err != nil {
+		return "", err
+	} else if fileInfo == util.FileInfoResultNotExists && mustExist {
+		return "", newOptionError(fmt.Sprintf(i18n.T("-%s 路径 %s 不存在"), name, dir))
+	} else if fileInfo == util.FileInfoResultExistFile {
+		return "", newOptionError(fmt.Sprintf(i18n.T("-%s 路径 %s 不是文件夹"), name, dir))
+	}
+	dirAbsPath, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf(i18n.T("获取 -%s 路径 %s 的绝对路径失败：%w"), name, dir, err)
+	}
+	return dirAbsPath, nil
+}
+
+// getDirArgs 检查可以重复指定的选项 -name 中的全部文件夹，至少需要一个
+func getDirArgs(name string, dirs []string) ([]string, error) {
+	if len(dirs) == 0 {
+		return nil, newOptionError(fmt.Sprintf(i18n.T("缺少 -%s 选项"), name))
+	}
+	dirAbsPaths := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		dirAbsPath, err := getDirArg(name, dir, true)
+		if err != nil {
+			return nil, err
+		}
+		dirAbsPaths = append(dirAbsPaths, dirAbsPath)
+	}
+	return dirAbsPaths, nil
+}
+
+// getSymlinkPolicy 解析 -symlink-policy 选项
+func getSymlinkPolicy(value string) (patch.SymlinkPolicy, error) {
+	symlinkPolicy, err := patch.ParseSymlinkPolicy(value)
+	if err != nil {
+		return "", newOptionError(err.Error())
+	}
+	return symlinkPolicy, nil
+}
+
+// getCopyMode 解析 -copy-mode 选项
+func getCopyMode(value string) (patch.CopyMode, error) {
+	copyMode, err := patch.ParseCopyMode(value)
+	if err != nil {
+		return "", newOptionError(err.Error())
+	}
+	return copyMode, nil
+}
+
+// mkdirOutput 创建输出文件夹
+func mkdirOutput(dirAbsPath string) error {
+	if mkdirResult, err := util.MkdirIfNotExists(dirAbsPath); err != nil {
+		return fmt.Errorf(i18n.T("创建文件夹 %s 失败：%w"), dirAbsPath, err)
+	} else if mkdirResult == util.MkdirIfNotExistsResultExistsFile {
+		return fmt.Errorf(i18n.T("%s 路径存在，但不是文件夹"), dirAbsPath)
+	} else if mkdirResult == util.MkdirIfNotExistsResultOK {
+		log.Println(dirAbsPath, i18n.T("文件夹创建成功"))
+	}
+	return nil
+}
+
+func main() {
+	i18n.SetLang(i18n.DetectLang())
+	fs := flag.NewFlagSet("dirbsdiff", flag.ContinueOnError)
+	langFlag := fs.String("lang", "", "界面语言：zh、en")
+	timeoutFlag := fs.Duration("timeout", 0, "最长运行时间，0 表示不限制")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), help())
+	}
+	if err := fs.Parse(os.Args[1:]); err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		os.Exit(ExitUsage)
+	}
+	if *langFlag != "" {
+		lang, err := i18n.ParseLang(*langFlag)
+		if err != nil {
+			log.Print(err)
+			os.Exit(ExitUsage)
+		}
+		i18n.SetLang(lang)
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprint(os.Stderr, help())
+		os.Exit(ExitUsage)
+	}
+	name := fs.Arg(0)
+	if name == "help" {
+		fmt.Print(help())
+		return
+	}
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, i18n.T("未知的子命令：%s\n\n%s"), name, help())
+		os.Exit(ExitUsage)
+	}
+	if *timeoutFlag < 0 {
+		log.Print(i18n.T("-timeout 不能小于 0"))
+		os.Exit(ExitUsage)
+	}
+
+	// 收到中断信号或超时后取消 ctx，正在执行的操作删除未完成的文件后返回
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *timeoutFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeoutFlag)
+		defer cancel()
+	}
+	if err := run(ctx, fs.Args()[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return
+		} else if err != errUsage {
+			log.Print(err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ganlvtech/go-dir-bsdiff/delta"
+	"github.com/ganlvtech/go-dir-bsdiff/diff"
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// diffOptionFlags 是 diff 和 squash 共用的差异算法选项
+type diffOptionFlags struct {
+	codec         string
+	compression   string
+	zstdLevel     int
+	patchFromSize sizeFlag
+}
+
+func addDiffOptionFlags(fs *flag.FlagSet) *diffOptionFlags {
+	f := &diffOptionFlags{}
+	fs.StringVar(&f.codec, "codec", delta.BsDiffName, i18n.T("差异算法：")+strings.Join(append(delta.Names(), diff.AutoCodecName), i18n.T("、"))+i18n.T("，auto 对每一块尝试全部差异算法和压缩算法，保留最小的结果"))
+	fs.StringVar(&f.compression, "compression", delta.ZstdName, i18n.T("新增文件和新文件数据块的压缩算法：")+strings.Join(append(delta.CompressorNames(), diff.NoCompressionName), i18n.T("、")))
+	fs.IntVar(&f.zstdLevel, "zstd-level", 3, i18n.T("zstd 压缩等级 1~22"))
+	fs.Var(&f.patchFromSize, "patch-from-size", i18n.T("旧文件或新文件不小于这个大小时使用 zstd patch-from 模式，如 512MiB，0 表示不使用"))
+	return f
+}
+
+func (f *diffOptionFlags) options() (*diff.Options, error) {
+	if f.zstdLevel < 1 || f.zstdLevel > 22 {
+		return nil, newOptionError(fmt.Sprintf(i18n.T("-zstd-level %d 超出范围，必须是 1~22"), f.zstdLevel))
+	}
+	if f.patchFromSize < 0 {
+		return nil, newOptionError(i18n.T("-patch-from-size 不能是负数"))
+	}
+	options, err := diff.NewOptions(f.codec, f.compression, f.zstdLevel, int64(f.patchFromSize))
+	if err != nil {
+		return nil, newOptionError(err.Error())
+	}
+	return options, nil
+}
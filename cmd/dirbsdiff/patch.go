@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func runPatch(ctx context.Context, args []string) error {
+	fs := newFlagSet("patch", i18n.T("-old 旧文件夹路径 -new 新文件夹路径 -diff 差异文件夹路径 [选项]"))
+	oldFlag := fs.String("old", "", i18n.T("旧版文件夹路径"))
+	newFlag := fs.String("new", "", i18n.T("新版文件夹路径，不存在则会自动创建"))
+	diffFlag := fs.String("diff", "", i18n.T("差异文件夹路径，也可以是 http:// 或 https:// 地址，只下载需要的差异文件"))
+	symlinkPolicyFlag := fs.String("symlink-policy", string(patch.SymlinkPolicyAllow), i18n.T("指向新版文件夹之外的符号链接的处理方式：allow、skip 或 error"))
+	skipExistingFlag := fs.Bool("skip-existing", false, i18n.T("先计算新版文件夹中已经存在的文件的 MD5，跳过已经是新版的文件，用于继续上次中断的补丁"))
+	copyModeFlag := fs.String("copy-mode", string(patch.CopyModeCopy), i18n.T("copy 操作生成新版文件的方式：copy、hardlink 或 reflink，hardlink 和 reflink 失败时复制"))
+	sourceFlags := addSourceFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	oldDirAbsPath, err := getDirArg("old", *oldFlag, true)
+	if err != nil {
+		return err
+	}
+	newDirAbsPath, err := getDirArg("new", *newFlag, false)
+	if err != nil {
+		return err
+	}
+	if err := patch.CheckDirs(oldDirAbsPath, newDirAbsPath); err != nil {
+		return newOptionError(err.Error())
+	}
+	source, err := sourceFlags.source("diff", *diffFlag)
+	if err != nil {
+		return err
+	}
+	symlinkPolicy, err := getSymlinkPolicy(*symlinkPolicyFlag)
+	if err != nil {
+		return err
+	}
+	copyMode, err := getCopyMode(*copyModeFlag)
+	if err != nil {
+		return err
+	}
+	return patch.ApplySource(ctx, source, oldDirAbsPath, newDirAbsPath, &patch.ApplyOptions{
+		SymlinkPolicy: symlinkPolicy,
+		SkipExisting:  *skipExistingFlag,
+		CopyMode:      copyMode,
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func runServe(ctx context.Context, args []string) error {
+	fs := newFlagSet("serve", i18n.T("-dir 补丁文件夹路径 [选项]"))
+	dirFlag := fs.String("dir", "", i18n.T("补丁文件夹路径，其中每个子文件夹是一个差异文件夹"))
+	addrFlag := fs.String("addr", ":8080", i18n.T("监听地址"))
+	latestFlag := fs.String("latest", "", i18n.T("最新版本的版本哈希，为空时自动确定"))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	dirAbsPath, err := getDirArg("dir", *dirFlag, true)
+	if err != nil {
+		return err
+	}
+	index, err := patch.IndexPatches(dirAbsPath, *latestFlag)
+	if err != nil {
+		return err
+	}
+	log.Printf(i18n.T("找到 %d 个补丁，最新版本：%s"), len(index.Patches), index.Latest)
+
+	server := &http.Server{Addr: *addrFlag, Handler: patch.NewServer(dirAbsPath, *latestFlag)}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	log.Printf(i18n.T("正在监听 %s"), *addrFlag)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Println(i18n.T("服务器已停止"))
+	return nil
+}
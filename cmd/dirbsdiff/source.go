@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+// sourceFlags 是 patch 和 chain 共用的 HTTP 差异文件夹选项
+type sourceFlags struct {
+	retries    int
+	retryDelay time.Duration
+}
+
+func addSourceFlags(fs *flag.FlagSet) *sourceFlags {
+	f := &sourceFlags{}
+	fs.IntVar(&f.retries, "retries", patch.DefaultHTTPRetries, i18n.T("-diff 是 HTTP 地址时，每个文件请求失败或读取中断后的重试次数"))
+	fs.DurationVar(&f.retryDelay, "retry-delay", patch.DefaultHTTPRetryDelay, i18n.T("第一次重试前的等待时间，之后每次加倍"))
+	return f
+}
+
+// source 返回选项 -name 指定的差异文件夹，value 可以是本地文件夹或 HTTP 地址
+func (f *sourceFlags) source(name, value string) (patch.Source, error) {
+	if !patch.IsHTTPURL(value) {
+		dirAbsPath, err := getDirArg(name, value, true)
+		if err != nil {
+			return nil, err
+		}
+		return patch.DirSource(dirAbsPath), nil
+	}
+	if f.retries < 0 {
+		return nil, newOptionError(i18n.T("-retries 不能是负数"))
+	}
+	source, err := patch.NewHTTPSource(value)
+	if err != nil {
+		return nil, newOptionError(err.Error())
+	}
+	source.Retries = f.retries
+	source.RetryDelay = f.retryDelay
+	return source, nil
+}
+
+// sources 返回可以重复指定的选项 -name 中的全部差异文件夹，至少需要一个
+func (f *sourceFlags) sources(name string, values []string) ([]patch.Source, error) {
+	if len(values) == 0 {
+		return nil, newOptionError(fmt.Sprintf(i18n.T("缺少 -%s 选项"), name))
+	}
+	sources := make([]patch.Source, 0, len(values))
+	for _, value := range values {
+		source, err := f.source(name, value)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
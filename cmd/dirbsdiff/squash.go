@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ganlvtech/go-dir-bsdiff/diff"
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func runSquash(ctx context.Context, args []string) error {
+	fs := newFlagSet("squash", i18n.T("-old 旧文件夹路径 -out 输出差异文件夹路径 -diff 差异文件夹路径1 -diff 差异文件夹路径2 ... [选项]"))
+	oldFlag := fs.String("old", "", i18n.T("第一个补丁的旧版文件夹路径"))
+	outFlag := fs.String("out", "", i18n.T("输出差异文件夹路径，不存在则会自动创建"))
+	var diffFlag stringsFlag
+	fs.Var(&diffFlag, "diff", i18n.T("要合并的差异文件夹路径，按应用顺序重复指定"))
+	optionFlags := addDiffOptionFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	oldDirAbsPath, err := getDirArg("old", *oldFlag, true)
+	if err != nil {
+		return err
+	}
+	outDirAbsPath, err := getDirArg("out", *outFlag, false)
+	if err != nil {
+		return err
+	}
+	diffDirAbsPaths, err := getDirArgs("diff", diffFlag)
+	if err != nil {
+		return err
+	}
+	for _, diffDirAbsPath := range diffDirAbsPaths {
+		if diffDirAbsPath == outDirAbsPath {
+			return newOptionError(fmt.Sprintf(i18n.T("输出差异路径 %s 不能是要合并的补丁"), *outFlag))
+		}
+	}
+	diffOptions, err := optionFlags.options()
+	if err != nil {
+		return err
+	}
+	log.Println(i18n.T("旧版文件夹："), oldDirAbsPath)
+	log.Println(i18n.T("输出差异文件夹："), outDirAbsPath)
+	if err := mkdirOutput(outDirAbsPath); err != nil {
+		return err
+	}
+	manifest, err := diff.Squash(ctx, diffOptions, oldDirAbsPath, outDirAbsPath, diffDirAbsPaths)
+	if err != nil {
+		return err
+	}
+	if err := patch.WriteManifest(outDirAbsPath, manifest); err != nil {
+		return fmt.Errorf(i18n.T("输出补丁描述文件错误：%w"), err)
+	}
+	log.Println(i18n.T("合并成功"))
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func runVerify(ctx context.Context, args []string) error {
+	fs := newFlagSet("verify", i18n.T("-diff 差异文件夹路径 -dir 文件夹路径 [选项]"))
+	diffFlag := fs.String("diff", "", i18n.T("差异文件夹路径"))
+	dirFlag := fs.String("dir", "", i18n.T("要检查的文件夹路径"))
+	sideFlag := fs.String("side", "new", i18n.T("old 检查文件夹能否应用补丁，new 检查文件夹是否与补丁生成的新版一致"))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	diffDirAbsPath, err := getDirArg("diff", *diffFlag, true)
+	if err != nil {
+		return err
+	}
+	dirAbsPath, err := getDirArg("dir", *dirFlag, true)
+	if err != nil {
+		return err
+	}
+	manifest, err := patch.ReadManifest(diffDirAbsPath)
+	if err != nil {
+		return fmt.Errorf(i18n.T("读取补丁描述文件错误：%w"), err)
+	}
+	var result *patch.VerifyResult
+	var mismatchKind error
+	switch *sideFlag {
+	case "old":
+		result, err = patch.VerifyOld(manifest, dirAbsPath)
+		mismatchKind = patch.ErrOldHashMismatch
+	case "new":
+		result, err = patch.VerifyNew(manifest, dirAbsPath)
+		mismatchKind = patch.ErrNewHashMismatch
+	default:
+		return newOptionError(fmt.Sprintf(i18n.T("-side %s 无效，必须是 old 或 new"), *sideFlag))
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range result.Missing {
+		log.Println(i18n.T("缺少"), name)
+	}
+	for _, name := range result.Mismatched {
+		log.Println(i18n.T("不一致"), name)
+	}
+	if !result.OK() {
+		return &patch.Error{Kind: mismatchKind, Err: fmt.Errorf(i18n.T("校验失败：共检查 %d 项，缺少 %d 项，不一致 %d 项"), result.Checked, len(result.Missing), len(result.Mismatched))}
+	}
+	log.Printf(i18n.T("校验通过，共检查 %d 项"), result.Checked)
+	return nil
+}
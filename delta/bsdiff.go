@@ -0,0 +1,35 @@
+package delta
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/gabstv/go-bsdiff/pkg/bspatch"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+const BsDiffName = "bsdiff"
+
+type BsDiff struct{}
+
+func (BsDiff) Name() string {
+	return BsDiffName
+}
+
+// Diff 使用低内存的 bsdiffGenerate 生成差异，结果与 go-bsdiff 相同
+func (BsDiff) Diff(ctx context.Context, oldBytes, newBytes []byte) ([]byte, error) {
+	if len(oldBytes) > math.MaxInt32-1 {
+		return nil, fmt.Errorf(i18n.T("bsdiff 旧数据大小 %d 超过 2 GB"), len(oldBytes))
+	}
+	return bsdiffGenerate(ctx, oldBytes, newBytes)
+}
+
+func (BsDiff) Patch(oldBytes, diffBytes []byte) ([]byte, error) {
+	return bspatch.Bytes(oldBytes, diffBytes)
+}
+
+func init() {
+	Register(BsDiff{})
+}
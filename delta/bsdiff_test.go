@@ -0,0 +1,140 @@
+package delta
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/gabstv/go-bsdiff/pkg/bsdiff"
+)
+
+func bsdiffTestInputs() map[string][2][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := func(n int, alphabet int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(rng.Intn(alphabet))
+		}
+		return b
+	}
+	edit := func(b []byte, n int) []byte {
+		b = append([]byte(nil), b...)
+		for i := 0; i < n; i++ {
+			b[rng.Intn(len(b))] = byte(rng.Intn(256))
+		}
+		return b
+	}
+	base := random(100000, 256)
+	text := random(50000, 4)
+	periodic := bytes.Repeat([]byte("abcabcabd"), 3000)
+
+	inputs := map[string][2][]byte{
+		"都为空":       {nil, nil},
+		"旧版为空":      {nil, random(1000, 256)},
+		"新版为空":      {random(1000, 256), nil},
+		"一个字节":      {{1}, {1}},
+		"一个字节不同":    {{1}, {2}},
+		"全部相同的字节":   {bytes.Repeat([]byte{7}, 10000), bytes.Repeat([]byte{7}, 12000)},
+		"相同字节变为其他":  {bytes.Repeat([]byte{0}, 5000), append(bytes.Repeat([]byte{0}, 2500), bytes.Repeat([]byte{1}, 2500)...)},
+		"周期数据":      {periodic, edit(periodic, 10)},
+		"周期数据改变周期":  {periodic, bytes.Repeat([]byte("abcabd"), 4000)},
+		"随机修改":      {base, edit(base, 200)},
+		"插入和删除":     {base, append(append(append([]byte(nil), base[:30000]...), random(500, 256)...), base[40000:]...)},
+		"小字母表":      {text, edit(text, 100)},
+		"不相关":       {random(20000, 256), random(20000, 256)},
+		"新版是旧版的一部分": {base, base[20000:60000]},
+	}
+	for i := 0; i < 20; i++ {
+		oldBytes := random(rng.Intn(3000), 1+rng.Intn(256))
+		newBytes := edit(append(oldBytes[rng.Intn(len(oldBytes)+1):], random(rng.Intn(500), 256)...), rng.Intn(20)+1)
+		inputs[fmt.Sprintf("随机%d", i)] = [2][]byte{oldBytes, newBytes}
+	}
+	return inputs
+}
+
+func TestSuffixArray(t *testing.T) {
+	for name, input := range bsdiffTestInputs() {
+		text := input[0]
+		if len(text) > 20000 {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			want := make([]int32, len(text)+1)
+			for i := range want {
+				want[i] = int32(i)
+			}
+			sort.Slice(want, func(i, j int) bool {
+				return bytes.Compare(text[want[i]:], text[want[j]:]) < 0
+			})
+			got, err := suffixArray(context.Background(), text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("第 %d 项为 %d，期望 %d", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// bsdiffGenerate 的结果应该与 go-bsdiff 逐字节相同
+func TestBsDiffMatchesGoBsdiff(t *testing.T) {
+	for name, input := range bsdiffTestInputs() {
+		t.Run(name, func(t *testing.T) {
+			oldBytes, newBytes := input[0], input[1]
+			want, err := bsdiff.Bytes(oldBytes, newBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := BsDiff{}.Diff(context.Background(), oldBytes, newBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("差异数据与 go-bsdiff 不同，长度 %d，期望 %d", len(got), len(want))
+			}
+			patched, err := BsDiff{}.Patch(oldBytes, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(patched, newBytes) {
+				t.Fatal("还原结果与新版数据不一致")
+			}
+		})
+	}
+}
+
+// ctx 已取消时差异算法和压缩算法都应该返回 ctx 的错误，不处理完整个数据
+func TestCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rng := rand.New(rand.NewSource(1))
+	oldBytes := make([]byte, 4<<20)
+	rng.Read(oldBytes)
+	newBytes := make([]byte, 4<<20)
+	rng.Read(newBytes)
+	for _, name := range Names() {
+		codec, err := Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := codec.Diff(ctx, oldBytes, newBytes); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s：返回 %v，期望 context.Canceled", name, err)
+		}
+	}
+	for _, name := range CompressorNames() {
+		compressor, err := GetCompressor(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CompressBytes(ctx, compressor, newBytes); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s：返回 %v，期望 context.Canceled", name, err)
+		}
+	}
+}
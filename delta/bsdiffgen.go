@@ -0,0 +1,214 @@
+package delta
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/dsnet/compress/bzip2"
+)
+
+// 生成 BSDIFF40 格式差异数据，算法与 bsdiff 4.3 相同，生成的结果与 go-bsdiff 相同，但内存占用更少：
+//
+//   - 后缀数组使用 SA-IS 算法构造，下标为 int32，只需要 4 倍旧数据大小的内存，
+//     go-bsdiff 的 qsufsort 需要两个 int 数组，共 16 倍旧数据大小
+//   - 差异数据和额外数据直接写入各自的 bzip2 压缩流，不需要两个新数据大小的缓冲区
+//
+// 因为使用 int32 下标，旧数据不能超过 2 GB。
+
+// bsdiffOfftout 按 bsdiff 的格式写入 8 字节整数，最高位为符号位
+func bsdiffOfftout(x int, buf []byte) {
+	y := uint64(x)
+	if x < 0 {
+		y = uint64(-x) | 1<<63
+	}
+	binary.LittleEndian.PutUint64(buf, y)
+}
+
+func bsdiffMatchLen(oldBytes, newBytes []byte) int {
+	i := 0
+	for i < len(oldBytes) && i < len(newBytes) && oldBytes[i] == newBytes[i] {
+		i++
+	}
+	return i
+}
+
+// bsdiffSearch 在后缀数组 sa 中二分查找与 newBytes 最长的匹配，返回匹配长度和旧数据中的位置
+func bsdiffSearch(sa []int32, oldBytes, newBytes []byte) (int, int) {
+	st, en := 0, len(oldBytes)
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		pos := int(sa[x])
+		cmpLen := len(oldBytes) - pos
+		if cmpLen > len(newBytes) {
+			cmpLen = len(newBytes)
+		}
+		if bytes.Compare(oldBytes[pos:pos+cmpLen], newBytes[:cmpLen]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+	x := bsdiffMatchLen(oldBytes[sa[st]:], newBytes)
+	y := bsdiffMatchLen(oldBytes[sa[en]:], newBytes)
+	if x > y {
+		return x, int(sa[st])
+	}
+	return y, int(sa[en])
+}
+
+type bsdiffStream struct {
+	buf bytes.Buffer
+	w   *bzip2.Writer
+}
+
+func newBsdiffStream() (*bsdiffStream, error) {
+	s := &bsdiffStream{}
+	w, err := bzip2.NewWriter(&s.buf, &bzip2.WriterConfig{Level: bzip2.BestCompression})
+	if err != nil {
+		return nil, err
+	}
+	s.w = w
+	return s, nil
+}
+
+// bsdiffGenerate 生成差异数据，每扫描 cancelCheckInterval 字节新数据检查一次 ctx 是否已取消
+func bsdiffGenerate(ctx context.Context, oldBytes, newBytes []byte) ([]byte, error) {
+	sa, err := suffixArray(ctx, oldBytes)
+	if err != nil {
+		return nil, err
+	}
+	oldSize := len(oldBytes)
+	newSize := len(newBytes)
+
+	ctrl, err := newBsdiffStream()
+	if err != nil {
+		return nil, err
+	}
+	diff, err := newBsdiffStream()
+	if err != nil {
+		return nil, err
+	}
+	extra, err := newBsdiffStream()
+	if err != nil {
+		return nil, err
+	}
+
+	ctrlBuf := make([]byte, 24)
+	diffBuf := make([]byte, 0, 4096)
+	var scan, length, lastScan, lastPos, lastOffset, pos, checkedScan int
+	for scan < newSize {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < newSize; scan++ {
+			if scan-checkedScan >= cancelCheckInterval {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				checkedScan = scan
+			}
+			length, pos = bsdiffSearch(sa, oldBytes, newBytes[scan:])
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < oldSize && oldBytes[scsc+lastOffset] == newBytes[scsc] {
+					oldScore++
+				}
+			}
+			if length == oldScore && length != 0 || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < oldSize && oldBytes[scan+lastOffset] == newBytes[scan] {
+				oldScore--
+			}
+		}
+
+		if length == oldScore && scan != newSize {
+			continue
+		}
+
+		s, sf, lenf := 0, 0, 0
+		for i := 0; lastScan+i < scan && lastPos+i < oldSize; {
+			if oldBytes[lastPos+i] == newBytes[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf = s
+				lenf = i
+			}
+		}
+
+		lenb := 0
+		if scan < newSize {
+			s, sb := 0, 0
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if oldBytes[pos-i] == newBytes[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb = s
+					lenb = i
+				}
+			}
+		}
+
+		if lastScan+lenf > scan-lenb {
+			overlap := (lastScan + lenf) - (scan - lenb)
+			s, ss, lens := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if newBytes[lastScan+lenf-overlap+i] == oldBytes[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if newBytes[scan-lenb+i] == oldBytes[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss = s
+					lens = i + 1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		for i := 0; i < lenf; i += cap(diffBuf) {
+			diffBuf = diffBuf[:0]
+			for k := i; k < lenf && k < i+cap(diffBuf); k++ {
+				diffBuf = append(diffBuf, newBytes[lastScan+k]-oldBytes[lastPos+k])
+			}
+			if _, err := diff.w.Write(diffBuf); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := extra.w.Write(newBytes[lastScan+lenf : scan-lenb]); err != nil {
+			return nil, err
+		}
+
+		bsdiffOfftout(lenf, ctrlBuf[0:8])
+		bsdiffOfftout((scan-lenb)-(lastScan+lenf), ctrlBuf[8:16])
+		bsdiffOfftout((pos-lenb)-(lastPos+lenf), ctrlBuf[16:24])
+		if _, err := ctrl.w.Write(ctrlBuf); err != nil {
+			return nil, err
+		}
+
+		lastScan = scan - lenb
+		lastPos = pos - lenb
+		lastOffset = pos - scan
+	}
+
+	for _, stream := range []*bsdiffStream{ctrl, diff, extra} {
+		if err := stream.w.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 文件头：BSDIFF40、压缩后的控制数据长度、压缩后的差异数据长度、新数据长度
+	out := make([]byte, 32, 32+ctrl.buf.Len()+diff.buf.Len()+extra.buf.Len())
+	copy(out, "BSDIFF40")
+	bsdiffOfftout(ctrl.buf.Len(), out[8:16])
+	bsdiffOfftout(diff.buf.Len(), out[16:24])
+	bsdiffOfftout(newSize, out[24:32])
+	out = append(out, ctrl.buf.Bytes()...)
+	out = append(out, diff.buf.Bytes()...)
+	out = append(out, extra.buf.Bytes()...)
+	return out, nil
+}
@@ -0,0 +1,119 @@
+package delta
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// Compressor 是新文件数据的压缩算法，Name 会记录在补丁描述文件中，并作为压缩后文件的后缀名
+type Compressor interface {
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressors = make(map[string]Compressor)
+
+// RegisterCompressor 注册压缩算法，同名算法会被替换
+func RegisterCompressor(compressor Compressor) {
+	compressors[compressor.Name()] = compressor
+}
+
+func GetCompressor(name string) (Compressor, error) {
+	compressor, ok := compressors[name]
+	if !ok {
+		return nil, fmt.Errorf(i18n.T("未知的压缩算法：%s"), name)
+	}
+	return compressor, nil
+}
+
+// CompressorNames 返回全部已注册的压缩算法名称
+func CompressorNames() []string {
+	names := make([]string, 0, len(compressors))
+	for name := range compressors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CompressBytes 压缩 data，分段写入压缩流，每段之前检查 ctx 是否已取消
+func CompressBytes(ctx context.Context, compressor Compressor, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := compressor.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	for len(data) > 0 {
+		if err := ctx.Err(); err != nil {
+			w.Close()
+			return nil, err
+		}
+		n := min(len(data), cancelCheckInterval)
+		if _, err := w.Write(data[:n]); err != nil {
+			w.Close()
+			return nil, err
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const DeflateName = "deflate"
+
+type Deflate struct{}
+
+func (Deflate) Name() string {
+	return DeflateName
+}
+
+func (Deflate) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.BestCompression)
+}
+
+func (Deflate) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+const ZstdName = "zstd"
+
+// Zstd 是 Zstandard 压缩，Level 是 zstd 命令行的压缩等级 1~22，为 0 时使用默认等级 3
+type Zstd struct {
+	Level int
+}
+
+func (Zstd) Name() string {
+	return ZstdName
+}
+
+func (z Zstd) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := zstd.SpeedDefault
+	if z.Level > 0 {
+		level = zstd.EncoderLevelFromZstd(z.Level)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(level))
+}
+
+func (Zstd) NewReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+func init() {
+	RegisterCompressor(Deflate{})
+	RegisterCompressor(Zstd{})
+}
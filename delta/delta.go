@@ -0,0 +1,44 @@
+package delta
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// Codec 是差异算法，Name 会记录在补丁描述文件中，并作为差异文件的后缀名。Diff 在 ctx 取消时应该尽快返回 ctx 的错误
+type Codec interface {
+	Name() string
+	Diff(ctx context.Context, oldBytes, newBytes []byte) ([]byte, error)
+	Patch(oldBytes, diffBytes []byte) ([]byte, error)
+}
+
+// cancelCheckInterval 是差异算法和压缩算法检查 ctx 是否已取消的间隔，每处理这么多字节检查一次
+const cancelCheckInterval = 1 << 20
+
+var codecs = make(map[string]Codec)
+
+// Register 注册差异算法，同名算法会被替换
+func Register(codec Codec) {
+	codecs[codec.Name()] = codec
+}
+
+func Get(name string) (Codec, error) {
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf(i18n.T("未知的差异算法：%s"), name)
+	}
+	return codec, nil
+}
+
+// Names 返回全部已注册的差异算法名称
+func Names() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
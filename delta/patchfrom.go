@@ -0,0 +1,389 @@
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// 类似 zstd --patch-from，以旧文件作为原始字典用 zstd 压缩新文件，新文件边读取边压缩，只有旧文件需要完整读入内存。
+//
+// klauspost/compress 的编码器用固定大小的哈希表索引字典，字典很大时大部分位置会被覆盖，几乎找不到匹配，
+// 压缩等级越低能利用的字典越小（见 patchFromSizes）。因此新文件分段压缩，每段是一个独立的 zstd 帧，
+// 字典由旧文件中与这一段相同的几段数据拼接而成，用旧文件的分块哈希索引查找。每帧之前是一个 zstd 可跳过帧，
+// 内容是下一帧的长度和组成字典的每段数据在旧文件中的位置和长度，都是 8 字节小端整数。
+//
+// 旧文件不超过字典大小、新文件不超过一段时只生成一个以整个旧文件为字典的帧，不记录字典 ID，
+// 可以用 zstd -d --patch-from=旧文件 还原。分段生成的差异数据只能用 ZstdPatchFromPatch 还原。
+
+const (
+	// patchFromSegmentMagic 是记录字典范围的可跳过帧的魔数
+	patchFromSegmentMagic = 0x184D2A50
+	// patchFromMaxRanges 是每段的字典最多由旧文件中的几段组成
+	patchFromMaxRanges = 16
+	// patchFromMaxFrameSize 和 patchFromMaxDictSize 是每段压缩后和字典的最大长度，避免损坏的差异数据导致分配过多内存
+	patchFromMaxFrameSize = 64 << 20
+	patchFromMaxDictSize  = 64 << 20
+
+	// patchFromBlockSize 是旧文件哈希索引的块大小，新文件中至少有这么长的相同数据才能找到对应的字典范围
+	patchFromBlockSize = 64
+	patchFromHashBase  = 16777619
+)
+
+var errPatchFromCorrupt = i18n.Error("zstd patch-from 差异数据已损坏")
+
+// patchFromSizes 返回压缩等级能有效利用的字典大小和每段新文件的大小
+func patchFromSizes(level zstd.EncoderLevel) (dictSize int, segmentSize int) {
+	switch level {
+	case zstd.SpeedFastest:
+		return 128 << 10, 64 << 10
+	case zstd.SpeedDefault:
+		return 512 << 10, 256 << 10
+	case zstd.SpeedBetterCompression:
+		return 4 << 20, 2 << 20
+	default:
+		return 8 << 20, 4 << 20
+	}
+}
+
+// patchFromWindowSize 返回能覆盖字典和新数据的窗口大小
+func patchFromWindowSize(dictSize, newSize int64) int {
+	windowSize := zstd.MinWindowSize
+	for int64(windowSize) < dictSize+newSize && windowSize < zstd.MaxWindowSize {
+		windowSize <<= 1
+	}
+	return windowSize
+}
+
+// patchFromIndex 是旧文件每 patchFromBlockSize 字节一个块的哈希索引
+type patchFromIndex struct {
+	oldBytes []byte
+	table    []int32
+	mask     uint32
+	hits     []int
+}
+
+var patchFromHashBasePow = func() uint32 {
+	p := uint32(1)
+	for i := 0; i < patchFromBlockSize-1; i++ {
+		p *= patchFromHashBase
+	}
+	return p
+}()
+
+func patchFromHash(b []byte) uint32 {
+	var h uint32
+	for _, c := range b[:patchFromBlockSize] {
+		h = h*patchFromHashBase + uint32(c)
+	}
+	return h
+}
+
+func newPatchFromIndex(oldBytes []byte) *patchFromIndex {
+	tableSize := 1
+	for tableSize < len(oldBytes)/patchFromBlockSize*2 {
+		tableSize <<= 1
+	}
+	index := &patchFromIndex{oldBytes: oldBytes, table: make([]int32, tableSize), mask: uint32(tableSize - 1)}
+	for i := 0; i+patchFromBlockSize <= len(oldBytes); i += patchFromBlockSize {
+		h := patchFromHash(oldBytes[i:]) & index.mask
+		if index.table[h] == 0 {
+			index.table[h] = int32(i/patchFromBlockSize + 1)
+		}
+	}
+	return index
+}
+
+// patchFromRange 是旧文件中作为字典的一段
+type patchFromRange struct {
+	start int
+	end   int
+}
+
+// ranges 返回旧文件中与 segment 相同的块所在的几段，总长度不超过 dictSize，没有相同的块时返回 nil
+//
+// 相同的块按在旧文件中的位置分组，相距不超过一段的块为一组，按每组块的数量从多到少选择，
+// 每组向两边扩展，使总长度接近 dictSize，扩展后重叠的组合并为一段。
+func (index *patchFromIndex) ranges(segment []byte, dictSize int) []patchFromRange {
+	index.hits = index.hits[:0]
+	var h uint32
+	if len(segment) >= patchFromBlockSize {
+		h = patchFromHash(segment)
+	}
+	for pos := 0; pos+patchFromBlockSize <= len(segment); {
+		if block := int(index.table[h&index.mask]) - 1; block >= 0 {
+			oldPos := block * patchFromBlockSize
+			if bytes.Equal(index.oldBytes[oldPos:oldPos+patchFromBlockSize], segment[pos:pos+patchFromBlockSize]) {
+				index.hits = append(index.hits, oldPos)
+				pos += patchFromBlockSize
+				if pos+patchFromBlockSize <= len(segment) {
+					h = patchFromHash(segment[pos:])
+				}
+				continue
+			}
+		}
+		if pos+patchFromBlockSize < len(segment) {
+			h = (h-uint32(segment[pos])*patchFromHashBasePow)*patchFromHashBase + uint32(segment[pos+patchFromBlockSize])
+		}
+		pos++
+	}
+	if len(index.hits) == 0 {
+		return nil
+	}
+
+	hits := index.hits
+	sort.Ints(hits)
+	type group struct {
+		patchFromRange
+		count int
+	}
+	groups := []group{{patchFromRange{hits[0], hits[0] + patchFromBlockSize}, 1}}
+	for _, hit := range hits[1:] {
+		last := &groups[len(groups)-1]
+		if hit-last.end <= len(segment) {
+			last.end = hit + patchFromBlockSize
+			last.count++
+		} else {
+			groups = append(groups, group{patchFromRange{hit, hit + patchFromBlockSize}, 1})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].count > groups[j].count
+	})
+	selected := make([]patchFromRange, 0, len(groups))
+	total := 0
+	for _, g := range groups {
+		if len(selected) == patchFromMaxRanges {
+			break
+		}
+		if total+g.end-g.start > dictSize {
+			continue
+		}
+		selected = append(selected, g.patchFromRange)
+		total += g.end - g.start
+	}
+	if len(selected) == 0 {
+		// 一组已经超过字典大小时只使用这一组中间的部分
+		g := groups[0]
+		start := (g.start+g.end)/2 - dictSize/2
+		return []patchFromRange{{start, start + dictSize}}
+	}
+
+	padding := (dictSize - total) / len(selected) / 2
+	for i := range selected {
+		selected[i].start = max(selected[i].start-padding, 0)
+		selected[i].end = min(selected[i].end+padding, len(index.oldBytes))
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].start < selected[j].start
+	})
+	merged := selected[:1]
+	for _, r := range selected[1:] {
+		last := &merged[len(merged)-1]
+		if r.start <= last.end {
+			last.end = max(last.end, r.end)
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+// ZstdPatchFromDiff 以 oldBytes 为字典压缩 newReader 中的数据写入 w，level 是 zstd 命令行的压缩等级，为 0 时使用默认等级 3
+func ZstdPatchFromDiff(oldBytes []byte, newReader io.Reader, newSize int64, w io.Writer, level int) error {
+	encoderLevel := zstd.SpeedDefault
+	if level > 0 {
+		encoderLevel = zstd.EncoderLevelFromZstd(level)
+	}
+	dictSize, segmentSize := patchFromSizes(encoderLevel)
+	if len(oldBytes) <= dictSize && newSize <= int64(segmentSize) {
+		return zstdPatchFromFrame(oldBytes, newReader, newSize, w, encoderLevel)
+	}
+
+	var index *patchFromIndex
+	if len(oldBytes) > dictSize {
+		index = newPatchFromIndex(oldBytes)
+	}
+	segment := make([]byte, segmentSize)
+	var header, joined, frame []byte
+	for {
+		n, err := io.ReadFull(newReader, segment)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		ranges := []patchFromRange{{0, len(oldBytes)}}
+		if index != nil {
+			ranges = index.ranges(segment[:n], dictSize)
+		}
+		var dict []byte
+		if len(ranges) == 1 {
+			dict = oldBytes[ranges[0].start:ranges[0].end]
+		} else {
+			joined = joined[:0]
+			for _, r := range ranges {
+				joined = append(joined, oldBytes[r.start:r.end]...)
+			}
+			dict = joined
+		}
+		options := []zstd.EOption{
+			zstd.WithEncoderLevel(encoderLevel),
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(patchFromWindowSize(int64(len(dict)), int64(n))),
+		}
+		if len(dict) > 0 {
+			options = append(options, zstd.WithEncoderDictRaw(0, dict))
+		}
+		encoder, err := zstd.NewWriter(nil, options...)
+		if err != nil {
+			return err
+		}
+		frame = encoder.EncodeAll(segment[:n], frame[:0])
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+
+		header = binary.LittleEndian.AppendUint32(header[:0], patchFromSegmentMagic)
+		header = binary.LittleEndian.AppendUint32(header, uint32(8+16*len(ranges)))
+		header = binary.LittleEndian.AppendUint64(header, uint64(len(frame)))
+		for _, r := range ranges {
+			header = binary.LittleEndian.AppendUint64(header, uint64(r.start))
+			header = binary.LittleEndian.AppendUint64(header, uint64(r.end-r.start))
+		}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(frame); err != nil {
+			return err
+		}
+		if n < segmentSize {
+			return nil
+		}
+	}
+}
+
+// zstdPatchFromFrame 以整个 oldBytes 为字典把 newReader 中的数据压缩为一个帧
+func zstdPatchFromFrame(oldBytes []byte, newReader io.Reader, newSize int64, w io.Writer, encoderLevel zstd.EncoderLevel) error {
+	options := []zstd.EOption{
+		zstd.WithEncoderLevel(encoderLevel),
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithWindowSize(patchFromWindowSize(int64(len(oldBytes)), newSize)),
+	}
+	if len(oldBytes) > 0 {
+		options = append(options, zstd.WithEncoderDictRaw(0, oldBytes))
+	}
+	encoder, err := zstd.NewWriter(w, options...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(encoder, newReader); err != nil {
+		encoder.Close()
+		return err
+	}
+	return encoder.Close()
+}
+
+// ZstdPatchFromPatch 以 oldBytes 为字典解压 diffReader 中的数据写入 w，支持分段和单帧两种格式
+func ZstdPatchFromPatch(oldBytes []byte, diffReader io.Reader, w io.Writer) error {
+	r := bufio.NewReader(diffReader)
+	magic, err := r.Peek(4)
+	if err == io.EOF && len(magic) == 0 {
+		return nil
+	}
+	if err != nil || binary.LittleEndian.Uint32(magic) != patchFromSegmentMagic {
+		return zstdPatchFromDecodeFrames(oldBytes, r, w)
+	}
+
+	header := make([]byte, 8+16*patchFromMaxRanges)
+	var frame, joined, out []byte
+	for {
+		if _, err := io.ReadFull(r, header[:8]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		headerSize := binary.LittleEndian.Uint32(header[4:8])
+		if binary.LittleEndian.Uint32(header[0:4]) != patchFromSegmentMagic || headerSize < 8 || headerSize > uint32(len(header)) || headerSize%16 != 8 {
+			return errPatchFromCorrupt
+		}
+		if _, err := io.ReadFull(r, header[:headerSize]); err != nil {
+			return err
+		}
+		frameSize := binary.LittleEndian.Uint64(header[0:8])
+		if frameSize > patchFromMaxFrameSize {
+			return errPatchFromCorrupt
+		}
+		var dict []byte
+		joined = joined[:0]
+		for i := 8; i < int(headerSize); i += 16 {
+			start := binary.LittleEndian.Uint64(header[i : i+8])
+			size := binary.LittleEndian.Uint64(header[i+8 : i+16])
+			if start > uint64(len(oldBytes)) || size > uint64(len(oldBytes))-start {
+				return fmt.Errorf(i18n.T("zstd patch-from 字典范围 %d+%d 超出旧数据大小 %d"), start, size, len(oldBytes))
+			}
+			if headerSize == 8+16 {
+				dict = oldBytes[start : start+size]
+				break
+			}
+			if uint64(len(joined))+size > patchFromMaxDictSize {
+				return errPatchFromCorrupt
+			}
+			joined = append(joined, oldBytes[start:start+size]...)
+			dict = joined
+		}
+
+		if uint64(cap(frame)) < frameSize {
+			frame = make([]byte, frameSize)
+		}
+		frame = frame[:frameSize]
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return err
+		}
+		options := []zstd.DOption{
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(zstd.MaxWindowSize),
+		}
+		if len(dict) > 0 {
+			options = append(options, zstd.WithDecoderDictRaw(0, dict))
+		}
+		decoder, err := zstd.NewReader(nil, options...)
+		if err != nil {
+			return err
+		}
+		out, err = decoder.DecodeAll(frame, out[:0])
+		decoder.Close()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+}
+
+// zstdPatchFromDecodeFrames 以整个 oldBytes 为字典解压单帧格式的差异数据
+func zstdPatchFromDecodeFrames(oldBytes []byte, diffReader io.Reader, w io.Writer) error {
+	options := []zstd.DOption{
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxWindow(zstd.MaxWindowSize),
+	}
+	if len(oldBytes) > 0 {
+		options = append(options, zstd.WithDecoderDictRaw(0, oldBytes))
+	}
+	decoder, err := zstd.NewReader(diffReader, options...)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+	_, err = io.Copy(w, decoder)
+	return err
+}
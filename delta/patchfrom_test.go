@@ -0,0 +1,126 @@
+package delta
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// patchFromTestInput 返回随机的旧数据和修改后的新数据：少量字节被修改，中间插入和删除一段，前后两部分交换位置
+func patchFromTestInput(size int) ([]byte, []byte) {
+	rng := rand.New(rand.NewSource(int64(size)))
+	oldBytes := make([]byte, size)
+	rng.Read(oldBytes)
+	newBytes := append([]byte(nil), oldBytes...)
+	for i := 0; i < 1000; i++ {
+		newBytes[rng.Intn(len(newBytes))] ^= 1
+	}
+	inserted := make([]byte, 3000)
+	rng.Read(inserted)
+	newBytes = append(newBytes[:size/3:size/3], append(inserted, newBytes[size/3:]...)...)
+	newBytes = append(newBytes[:size/2:size/2], newBytes[size/2+5000:]...)
+	half := len(newBytes) / 2
+	newBytes = append(append([]byte(nil), newBytes[half:]...), newBytes[:half]...)
+	return oldBytes, newBytes
+}
+
+func patchFromRoundTrip(t *testing.T, oldBytes, newBytes []byte, level int) int {
+	t.Helper()
+	var diff bytes.Buffer
+	if err := ZstdPatchFromDiff(oldBytes, bytes.NewReader(newBytes), int64(len(newBytes)), &diff, level); err != nil {
+		t.Fatal(err)
+	}
+	diffSize := diff.Len()
+	var patched bytes.Buffer
+	if err := ZstdPatchFromPatch(oldBytes, &diff, &patched); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(patched.Bytes(), newBytes) {
+		t.Fatalf("还原结果与新版数据不一致，长度 %d，期望 %d", patched.Len(), len(newBytes))
+	}
+	return diffSize
+}
+
+func TestZstdPatchFromSize(t *testing.T) {
+	sizes := []int{2 << 20, 40 << 20}
+	if testing.Short() {
+		sizes = sizes[:1]
+	}
+	for _, size := range sizes {
+		oldBytes, newBytes := patchFromTestInput(size)
+		for _, level := range []int{1, 3, 9, 19} {
+			t.Run(fmt.Sprintf("%dMiB-level%d", size>>20, level), func(t *testing.T) {
+				diffSize := patchFromRoundTrip(t, oldBytes, newBytes, level)
+				// 修改、插入的数据和每段的帧头之外都应该引用旧数据
+				if diffSize > len(newBytes)/100 {
+					t.Errorf("差异数据 %d 字节，新版数据 %d 字节", diffSize, len(newBytes))
+				}
+			})
+		}
+	}
+}
+
+func TestZstdPatchFromRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+	tests := map[string][2][]byte{
+		"都为空":    {nil, nil},
+		"旧版为空":   {nil, random(300000)},
+		"新版为空":   {random(300000), nil},
+		"小文件":    {random(1000), random(1000)},
+		"不相关":    {random(3 << 20), random(1 << 20)},
+		"新版是一整段": {random(2 << 20), random(256 << 10)},
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			patchFromRoundTrip(t, input[0], input[1], 3)
+		})
+	}
+}
+
+// 以前生成的差异数据是以整个旧数据为字典的一个 zstd 帧
+func TestZstdPatchFromPatchSingleFrame(t *testing.T) {
+	oldBytes, newBytes := patchFromTestInput(2 << 20)
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderDictRaw(0, oldBytes), zstd.WithWindowSize(patchFromWindowSize(int64(len(oldBytes)), int64(len(newBytes)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffBytes := encoder.EncodeAll(newBytes, nil)
+	encoder.Close()
+
+	var patched bytes.Buffer
+	if err := ZstdPatchFromPatch(oldBytes, bytes.NewReader(diffBytes), &patched); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(patched.Bytes(), newBytes) {
+		t.Fatal("还原结果与新版数据不一致")
+	}
+}
+
+func TestZstdPatchFromPatchCorrupt(t *testing.T) {
+	oldBytes, newBytes := patchFromTestInput(2 << 20)
+	var diff bytes.Buffer
+	if err := ZstdPatchFromDiff(oldBytes, bytes.NewReader(newBytes), int64(len(newBytes)), &diff, 3); err != nil {
+		t.Fatal(err)
+	}
+	diffBytes := diff.Bytes()
+
+	truncated := diffBytes[:len(diffBytes)-10]
+	windowOutOfRange := append([]byte(nil), diffBytes...)
+	windowOutOfRange[16+7] = 0xFF
+	frameTooLarge := append([]byte(nil), diffBytes...)
+	frameTooLarge[8+7] = 0xFF
+
+	for name, diffBytes := range map[string][]byte{"数据不完整": truncated, "字典范围超出旧数据": windowOutOfRange, "帧过大": frameTooLarge} {
+		if err := ZstdPatchFromPatch(oldBytes, bytes.NewReader(diffBytes), &bytes.Buffer{}); err == nil {
+			t.Errorf("%s：没有返回错误", name)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package delta
+
+import "context"
+
+// SA-IS 后缀数组构造算法（Nong, Zhang, Chan 2009），全部使用 int32 下标，
+// 除结果外只需要 n/8 字节的类型标记和字母表大小的桶数组，递归时复用结果数组的空间。
+// 文本末尾视为有一个比所有字符都小的虚拟哨兵字符。
+
+type saisBitset []uint64
+
+func newSaisBitset(n int) saisBitset {
+	return make(saisBitset, (n+63)/64)
+}
+
+func (b saisBitset) get(i int) bool {
+	return b[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+func (b saisBitset) set(i int) {
+	b[i/64] |= 1 << (uint(i) % 64)
+}
+
+// suffixArray 返回 text 的后缀数组，第一项为空后缀 len(text)，与 bsdiff 使用的 qsufsort 结果相同
+//
+// 构造过程中每一步之前检查 ctx 是否已取消
+func suffixArray(ctx context.Context, text []byte) ([]int32, error) {
+	sa := make([]int32, len(text)+1)
+	sa[0] = int32(len(text))
+	if len(text) > 0 {
+		if err := sais(ctx, text, sa[1:], 256); err != nil {
+			return nil, err
+		}
+	}
+	return sa, nil
+}
+
+func saisBuckets[T byte | int32](text []T, counts []int32, bkt []int32, end bool) {
+	for i := range counts {
+		counts[i] = 0
+	}
+	for _, c := range text {
+		counts[c]++
+	}
+	sum := int32(0)
+	for i, count := range counts {
+		sum += count
+		if end {
+			bkt[i] = sum
+		} else {
+			bkt[i] = sum - count
+		}
+	}
+}
+
+func saisInduce[T byte | int32](text []T, sa []int32, isS saisBitset, counts []int32, bkt []int32) {
+	n := len(text)
+	saisBuckets(text, counts, bkt, false)
+	// 哨兵之前的后缀 n-1 一定是 L 型，排在它所在桶的最前面
+	last := text[n-1]
+	sa[bkt[last]] = int32(n - 1)
+	bkt[last]++
+	for i := 0; i < n; i++ {
+		if sa[i] > 0 {
+			j := int(sa[i]) - 1
+			if !isS.get(j) {
+				sa[bkt[text[j]]] = int32(j)
+				bkt[text[j]]++
+			}
+		}
+	}
+	saisBuckets(text, counts, bkt, true)
+	for i := n - 1; i >= 0; i-- {
+		if sa[i] > 0 {
+			j := int(sa[i]) - 1
+			if isS.get(j) {
+				bkt[text[j]]--
+				sa[bkt[text[j]]] = int32(j)
+			}
+		}
+	}
+}
+
+// sais 计算 text 的后缀数组写入 sa，k 是字母表大小
+func sais[T byte | int32](ctx context.Context, text []T, sa []int32, k int) error {
+	n := len(text)
+	if n == 1 {
+		sa[0] = 0
+		return nil
+	}
+
+	isS := newSaisBitset(n)
+	for i := n - 2; i >= 0; i-- {
+		if text[i] < text[i+1] || text[i] == text[i+1] && isS.get(i+1) {
+			isS.set(i)
+		}
+	}
+	isLMS := func(i int) bool {
+		return i > 0 && isS.get(i) && !isS.get(i-1)
+	}
+
+	counts := make([]int32, k)
+	bkt := make([]int32, k)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// 第一步：LMS 后缀放在各自桶的末尾，诱导排序得到有序的 LMS 子串
+	for i := range sa {
+		sa[i] = -1
+	}
+	saisBuckets(text, counts, bkt, true)
+	for i := 1; i < n; i++ {
+		if isLMS(i) {
+			bkt[text[i]]--
+			sa[bkt[text[i]]] = int32(i)
+		}
+	}
+	saisInduce(text, sa, isS, counts, bkt)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// 第二步：给 LMS 子串命名，相同的子串名称相同
+	n1 := 0
+	for i := 0; i < n; i++ {
+		if isLMS(int(sa[i])) {
+			sa[n1] = sa[i]
+			n1++
+		}
+	}
+	for i := n1; i < n; i++ {
+		sa[i] = -1
+	}
+	name := 0
+	prev := -1
+	for i := 0; i < n1; i++ {
+		pos := int(sa[i])
+		diff := prev < 0
+		for d := 0; !diff; d++ {
+			if pos+d == n || prev+d == n || text[pos+d] != text[prev+d] || isS.get(pos+d) != isS.get(prev+d) {
+				diff = true
+			} else if d > 0 && (isLMS(pos+d) || isLMS(prev+d)) {
+				diff = !(isLMS(pos+d) && isLMS(prev+d))
+				break
+			}
+		}
+		if diff {
+			name++
+			prev = pos
+		}
+		// 相邻 LMS 位置至少相隔 2，pos/2 不会冲突
+		sa[n1+pos/2] = int32(name - 1)
+	}
+	j := n - 1
+	for i := n - 1; i >= n1; i-- {
+		if sa[i] >= 0 {
+			sa[j] = sa[i]
+			j--
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// 第三步：名称不唯一时递归计算缩减后字符串的后缀数组，得到 LMS 后缀的顺序
+	s1 := sa[n-n1:]
+	sa1 := sa[:n1]
+	if name < n1 {
+		if err := sais(ctx, s1, sa1, name); err != nil {
+			return err
+		}
+	} else {
+		for i := 0; i < n1; i++ {
+			sa1[s1[i]] = int32(i)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// 第四步：有序的 LMS 后缀放在各自桶的末尾，诱导排序得到完整的后缀数组
+	j = 0
+	for i := 1; i < n; i++ {
+		if isLMS(i) {
+			s1[j] = int32(i)
+			j++
+		}
+	}
+	for i := 0; i < n1; i++ {
+		sa1[i] = s1[sa1[i]]
+	}
+	for i := n1; i < n; i++ {
+		sa[i] = -1
+	}
+	saisBuckets(text, counts, bkt, true)
+	for i := n1 - 1; i >= 0; i-- {
+		pos := sa[i]
+		sa[i] = -1
+		bkt[text[pos]]--
+		sa[bkt[text[pos]]] = pos
+	}
+	saisInduce(text, sa, isS, counts, bkt)
+	return nil
+}
@@ -0,0 +1,617 @@
+package delta
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"math"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// VCDIFF 差异格式，参见 RFC 3284
+//
+// 生成时整个旧版数据作为一个源数据段，新版数据作为一个目标窗口，只使用默认指令表，不使用二级压缩。
+// 还原时可以读取其他实现（如 xdelta3 -S none）生成的多窗口差异文件。
+
+const VcDiffName = "vcdiff"
+
+const (
+	vcdHeaderIndicatorDecompress = 0x01
+	vcdHeaderIndicatorCodeTable  = 0x02
+	vcdHeaderIndicatorAppHeader  = 0x04
+
+	vcdWindowIndicatorSource  = 0x01
+	vcdWindowIndicatorTarget  = 0x02
+	vcdWindowIndicatorAdler32 = 0x04
+
+	vcdNearCacheSize = 4
+	vcdSameCacheSize = 3
+
+	vcdModeSelf = 0
+	vcdModeHere = 1
+
+	// 源数据按块建立索引，匹配长度至少为一个块
+	vcdBlockSize = 16
+	// 连续相同字节达到这个长度时使用 RUN 指令
+	vcdMinRunLength = 32
+
+	// vcdMaxTargetLength 是还原结果的长度上限，与分块大小的上限相同
+	vcdMaxTargetLength = math.MaxInt32 - 1
+)
+
+var vcdMagic = []byte{0xD6, 0xC3, 0xC4, 0x00}
+
+type vcdInstructionType byte
+
+const (
+	vcdNoop vcdInstructionType = iota
+	vcdAdd
+	vcdRun
+	vcdCopy
+)
+
+type vcdInstruction struct {
+	typ  vcdInstructionType
+	size int
+	mode int
+}
+
+type vcdCodeTableEntry [2]vcdInstruction
+
+// vcdDefaultCodeTable 是 RFC 3284 5.6 节的默认指令表
+var vcdDefaultCodeTable = buildVcdDefaultCodeTable()
+
+func buildVcdDefaultCodeTable() (table [256]vcdCodeTableEntry) {
+	i := 0
+	table[i] = vcdCodeTableEntry{{typ: vcdRun}}
+	i++
+	for size := 0; size <= 17; size++ {
+		table[i] = vcdCodeTableEntry{{typ: vcdAdd, size: size}}
+		i++
+	}
+	for mode := 0; mode < 9; mode++ {
+		table[i] = vcdCodeTableEntry{{typ: vcdCopy, mode: mode}}
+		i++
+		for size := 4; size <= 18; size++ {
+			table[i] = vcdCodeTableEntry{{typ: vcdCopy, size: size, mode: mode}}
+			i++
+		}
+	}
+	for mode := 0; mode < 6; mode++ {
+		for addSize := 1; addSize <= 4; addSize++ {
+			for copySize := 4; copySize <= 6; copySize++ {
+				table[i] = vcdCodeTableEntry{{typ: vcdAdd, size: addSize}, {typ: vcdCopy, size: copySize, mode: mode}}
+				i++
+			}
+		}
+	}
+	for mode := 6; mode < 9; mode++ {
+		for addSize := 1; addSize <= 4; addSize++ {
+			table[i] = vcdCodeTableEntry{{typ: vcdAdd, size: addSize}, {typ: vcdCopy, size: 4, mode: mode}}
+			i++
+		}
+	}
+	for mode := 0; mode < 9; mode++ {
+		table[i] = vcdCodeTableEntry{{typ: vcdCopy, size: 4, mode: mode}, {typ: vcdAdd, size: 1}}
+		i++
+	}
+	return table
+}
+
+type vcdAddressCache struct {
+	near     [vcdNearCacheSize]int
+	nextSlot int
+	same     [vcdSameCacheSize * 256]int
+}
+
+func (c *vcdAddressCache) update(addr int) {
+	c.near[c.nextSlot] = addr
+	c.nextSlot = (c.nextSlot + 1) % vcdNearCacheSize
+	c.same[addr%len(c.same)] = addr
+}
+
+// encode 选择编码后最短的地址模式，返回模式和编码后的地址
+func (c *vcdAddressCache) encode(addr, here int) (int, []byte) {
+	bestMode := vcdModeSelf
+	best := appendVarint(nil, addr)
+	if encoded := appendVarint(nil, here-addr); len(encoded) < len(best) {
+		bestMode = vcdModeHere
+		best = encoded
+	}
+	for i, near := range c.near {
+		if addr >= near {
+			if encoded := appendVarint(nil, addr-near); len(encoded) < len(best) {
+				bestMode = 2 + i
+				best = encoded
+			}
+		}
+	}
+	if c.same[addr%len(c.same)] == addr {
+		slot := addr % len(c.same)
+		bestMode = 2 + vcdNearCacheSize + slot/256
+		best = []byte{byte(slot % 256)}
+	}
+	c.update(addr)
+	return bestMode, best
+}
+
+func (c *vcdAddressCache) decode(mode, here int, addresses *vcdReader) (int, error) {
+	var addr int
+	switch {
+	case mode == vcdModeSelf:
+		value, err := addresses.varint()
+		if err != nil {
+			return 0, err
+		}
+		addr = value
+	case mode == vcdModeHere:
+		value, err := addresses.varint()
+		if err != nil {
+			return 0, err
+		}
+		addr = here - value
+	case mode < 2+vcdNearCacheSize:
+		value, err := addresses.varint()
+		if err != nil {
+			return 0, err
+		}
+		addr = c.near[mode-2] + value
+	case mode < 2+vcdNearCacheSize+vcdSameCacheSize:
+		b, err := addresses.byte()
+		if err != nil {
+			return 0, err
+		}
+		addr = c.same[(mode-2-vcdNearCacheSize)*256+int(b)]
+	default:
+		return 0, fmt.Errorf(i18n.T("VCDIFF 地址模式 %d 无效"), mode)
+	}
+	if addr < 0 || addr >= here {
+		return 0, fmt.Errorf(i18n.T("VCDIFF 复制地址 %d 超出范围"), addr)
+	}
+	c.update(addr)
+	return addr, nil
+}
+
+func appendVarint(buf []byte, value int) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(value & 0x7F)
+	value >>= 7
+	for value > 0 {
+		i--
+		tmp[i] = byte(value&0x7F) | 0x80
+		value >>= 7
+	}
+	return append(buf, tmp[i:]...)
+}
+
+var errVcdUnexpectedEnd = i18n.Error("VCDIFF 数据意外结束")
+
+type vcdReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *vcdReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errVcdUnexpectedEnd
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *vcdReader) varint() (int, error) {
+	value := 0
+	for i := 0; i < 9; i++ {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<7 | int(b&0x7F)
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errors.New(i18n.T("VCDIFF 整数过大"))
+}
+
+func (r *vcdReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, errVcdUnexpectedEnd
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *vcdReader) done() bool {
+	return r.pos >= len(r.data)
+}
+
+type VcDiff struct{}
+
+func (VcDiff) Name() string {
+	return VcDiffName
+}
+
+type vcdEncoder struct {
+	sourceLen    int
+	instructions []vcdInstruction
+	data         []byte
+	addresses    [][]byte
+	cache        vcdAddressCache
+	targetPos    int
+}
+
+func (e *vcdEncoder) add(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	e.instructions = append(e.instructions, vcdInstruction{typ: vcdAdd, size: len(b)})
+	e.addresses = append(e.addresses, nil)
+	e.data = append(e.data, b...)
+	e.targetPos += len(b)
+}
+
+func (e *vcdEncoder) run(b byte, size int) {
+	e.instructions = append(e.instructions, vcdInstruction{typ: vcdRun, size: size})
+	e.addresses = append(e.addresses, nil)
+	e.data = append(e.data, b)
+	e.targetPos += size
+}
+
+func (e *vcdEncoder) copy(addr, size int) {
+	mode, encoded := e.cache.encode(addr, e.sourceLen+e.targetPos)
+	e.instructions = append(e.instructions, vcdInstruction{typ: vcdCopy, size: size, mode: mode})
+	e.addresses = append(e.addresses, encoded)
+	e.targetPos += size
+}
+
+// encodeInstructions 使用默认指令表编码指令，能合并为一个指令码的相邻两条指令会被合并
+func (e *vcdEncoder) encodeInstructions() (instructions []byte, addresses []byte) {
+	single := make(map[vcdInstruction]int)
+	double := make(map[vcdCodeTableEntry]int)
+	for code, entry := range vcdDefaultCodeTable {
+		if entry[1].typ == vcdNoop {
+			single[entry[0]] = code
+		} else {
+			double[entry] = code
+		}
+	}
+	for i := 0; i < len(e.instructions); i++ {
+		inst := e.instructions[i]
+		if i+1 < len(e.instructions) {
+			if code, ok := double[vcdCodeTableEntry{inst, e.instructions[i+1]}]; ok {
+				instructions = append(instructions, byte(code))
+				addresses = append(addresses, e.addresses[i]...)
+				addresses = append(addresses, e.addresses[i+1]...)
+				i++
+				continue
+			}
+		}
+		if code, ok := single[inst]; ok {
+			instructions = append(instructions, byte(code))
+		} else {
+			code := single[vcdInstruction{typ: inst.typ, mode: inst.mode}]
+			instructions = append(instructions, byte(code))
+			instructions = appendVarint(instructions, inst.size)
+		}
+		addresses = append(addresses, e.addresses[i]...)
+	}
+	return instructions, addresses
+}
+
+func vcdHashBlock(b []byte) uint32 {
+	var h uint32
+	for _, c := range b {
+		h = h*vcdHashBase + uint32(c)
+	}
+	return h
+}
+
+const vcdHashBase = 16777619
+
+// vcdHashBasePow 是 vcdHashBase 的 vcdBlockSize-1 次方，用于滚动哈希移出最早的字节
+var vcdHashBasePow = func() uint32 {
+	p := uint32(1)
+	for i := 0; i < vcdBlockSize-1; i++ {
+		p *= vcdHashBase
+	}
+	return p
+}()
+
+func vcdRunLength(b []byte, limit int) int {
+	n := 1
+	for n < len(b) && n < limit && b[n] == b[0] {
+		n++
+	}
+	return n
+}
+
+// Diff 生成差异数据，每处理 cancelCheckInterval 字节新数据检查一次 ctx 是否已取消
+func (VcDiff) Diff(ctx context.Context, oldBytes, newBytes []byte) ([]byte, error) {
+	e := &vcdEncoder{sourceLen: len(oldBytes)}
+
+	// 旧版数据每 vcdBlockSize 字节建立一个索引
+	tableSize := 1
+	for tableSize < len(oldBytes)/vcdBlockSize*2 {
+		tableSize <<= 1
+	}
+	mask := uint32(tableSize - 1)
+	table := make([]int32, tableSize)
+	for i := 0; i+vcdBlockSize <= len(oldBytes); i += vcdBlockSize {
+		h := vcdHashBlock(oldBytes[i:i+vcdBlockSize]) & mask
+		if table[h] == 0 {
+			table[h] = int32(i + 1)
+		}
+	}
+
+	pos := 0
+	addStart := 0
+	var h uint32
+	if len(newBytes) >= vcdBlockSize {
+		h = vcdHashBlock(newBytes[:vcdBlockSize])
+	}
+	checkedPos := 0
+	for pos+vcdBlockSize <= len(newBytes) {
+		if pos-checkedPos >= cancelCheckInterval {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			checkedPos = pos
+		}
+		if runLength := vcdRunLength(newBytes[pos:], vcdMinRunLength); runLength >= vcdMinRunLength {
+			runLength = vcdRunLength(newBytes[pos:], len(newBytes))
+			e.add(newBytes[addStart:pos])
+			e.run(newBytes[pos], runLength)
+			pos += runLength
+			addStart = pos
+			if pos+vcdBlockSize <= len(newBytes) {
+				h = vcdHashBlock(newBytes[pos : pos+vcdBlockSize])
+			}
+			continue
+		}
+		if candidate := int(table[h&mask]) - 1; candidate >= 0 && bytes.Equal(oldBytes[candidate:candidate+vcdBlockSize], newBytes[pos:pos+vcdBlockSize]) {
+			matchLength := vcdBlockSize
+			for candidate+matchLength < len(oldBytes) && pos+matchLength < len(newBytes) && oldBytes[candidate+matchLength] == newBytes[pos+matchLength] {
+				matchLength++
+			}
+			back := 0
+			for pos-back > addStart && candidate-back > 0 && oldBytes[candidate-back-1] == newBytes[pos-back-1] {
+				back++
+			}
+			e.add(newBytes[addStart : pos-back])
+			e.copy(candidate-back, matchLength+back)
+			pos += matchLength
+			addStart = pos
+			if pos+vcdBlockSize <= len(newBytes) {
+				h = vcdHashBlock(newBytes[pos : pos+vcdBlockSize])
+			}
+			continue
+		}
+		if pos+vcdBlockSize < len(newBytes) {
+			h = (h-uint32(newBytes[pos])*vcdHashBasePow)*vcdHashBase + uint32(newBytes[pos+vcdBlockSize])
+		}
+		pos++
+	}
+	e.add(newBytes[addStart:])
+
+	instructions, addresses := e.encodeInstructions()
+
+	var window []byte
+	window = appendVarint(window, len(newBytes))
+	window = append(window, 0)
+	window = appendVarint(window, len(e.data))
+	window = appendVarint(window, len(instructions))
+	window = appendVarint(window, len(addresses))
+	window = append(window, e.data...)
+	window = append(window, instructions...)
+	window = append(window, addresses...)
+
+	out := make([]byte, 0, len(vcdMagic)+16+len(window))
+	out = append(out, vcdMagic...)
+	out = append(out, 0)
+	if len(oldBytes) > 0 {
+		out = append(out, vcdWindowIndicatorSource)
+		out = appendVarint(out, len(oldBytes))
+		out = appendVarint(out, 0)
+	} else {
+		out = append(out, 0)
+	}
+	out = appendVarint(out, len(window))
+	out = append(out, window...)
+	return out, nil
+}
+
+func (VcDiff) Patch(oldBytes, diffBytes []byte) ([]byte, error) {
+	r := &vcdReader{data: diffBytes}
+	magic, err := r.bytes(len(vcdMagic))
+	if err != nil || !bytes.Equal(magic[:3], vcdMagic[:3]) {
+		return nil, errors.New(i18n.T("不是 VCDIFF 格式"))
+	}
+	headerIndicator, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if headerIndicator&vcdHeaderIndicatorDecompress != 0 {
+		return nil, errors.New(i18n.T("不支持 VCDIFF 二级压缩"))
+	}
+	if headerIndicator&vcdHeaderIndicatorCodeTable != 0 {
+		return nil, errors.New(i18n.T("不支持 VCDIFF 自定义指令表"))
+	}
+	if headerIndicator&vcdHeaderIndicatorAppHeader != 0 {
+		appHeaderLength, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.bytes(appHeaderLength); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []byte
+	for !r.done() {
+		out, err = vcdDecodeWindow(r, oldBytes, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func vcdDecodeWindow(r *vcdReader, oldBytes []byte, out []byte) ([]byte, error) {
+	windowIndicator, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if windowIndicator&vcdWindowIndicatorTarget != 0 {
+		return nil, errors.New(i18n.T("不支持 VCDIFF VCD_TARGET 窗口"))
+	}
+	var source []byte
+	if windowIndicator&vcdWindowIndicatorSource != 0 {
+		sourceLength, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		sourcePosition, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		if sourceLength > len(oldBytes) || sourcePosition > len(oldBytes)-sourceLength {
+			return nil, errors.New(i18n.T("VCDIFF 源数据段超出旧版数据范围"))
+		}
+		source = oldBytes[sourcePosition : sourcePosition+sourceLength]
+	}
+	deltaLength, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	deltaBytes, err := r.bytes(deltaLength)
+	if err != nil {
+		return nil, err
+	}
+	d := &vcdReader{data: deltaBytes}
+	targetLength, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	deltaIndicator, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	// 长度都来自差异文件，先检查范围，避免分配过多内存
+	if targetLength > vcdMaxTargetLength-len(out) {
+		return nil, fmt.Errorf(i18n.T("VCDIFF 目标窗口长度 %d 超出范围"), targetLength)
+	}
+	if deltaIndicator != 0 {
+		return nil, errors.New(i18n.T("不支持 VCDIFF 二级压缩"))
+	}
+	dataLength, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	instructionsLength, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	addressesLength, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	var checksum []byte
+	if windowIndicator&vcdWindowIndicatorAdler32 != 0 {
+		checksum, err = d.bytes(4)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dataBytes, err := d.bytes(dataLength)
+	if err != nil {
+		return nil, err
+	}
+	instructionsBytes, err := d.bytes(instructionsLength)
+	if err != nil {
+		return nil, err
+	}
+	addressesBytes, err := d.bytes(addressesLength)
+	if err != nil {
+		return nil, err
+	}
+	data := &vcdReader{data: dataBytes}
+	instructions := &vcdReader{data: instructionsBytes}
+	addresses := &vcdReader{data: addressesBytes}
+
+	// RUN 和 COPY 指令可以展开成比差异文件大得多的数据，预分配的长度不超过源数据段和新增数据的长度，不够时再扩展
+	target := make([]byte, 0, min(targetLength, len(source)+len(dataBytes)))
+	cache := &vcdAddressCache{}
+	for !instructions.done() {
+		code, err := instructions.byte()
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range vcdDefaultCodeTable[code] {
+			if inst.typ == vcdNoop {
+				continue
+			}
+			size := inst.size
+			if size == 0 {
+				size, err = instructions.varint()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if size > targetLength-len(target) {
+				return nil, errors.New(i18n.T("VCDIFF 目标窗口长度超出声明的长度"))
+			}
+			switch inst.typ {
+			case vcdAdd:
+				b, err := data.bytes(size)
+				if err != nil {
+					return nil, err
+				}
+				target = append(target, b...)
+			case vcdRun:
+				b, err := data.byte()
+				if err != nil {
+					return nil, err
+				}
+				for i := 0; i < size; i++ {
+					target = append(target, b)
+				}
+			case vcdCopy:
+				addr, err := cache.decode(inst.mode, len(source)+len(target), addresses)
+				if err != nil {
+					return nil, err
+				}
+				if addr+size <= len(source) {
+					target = append(target, source[addr:addr+size]...)
+				} else {
+					// 复制范围可以从源数据段延伸到目标窗口，也可以与正在写入的数据重叠
+					for i := addr; i < addr+size; i++ {
+						if i < len(source) {
+							target = append(target, source[i])
+						} else {
+							target = append(target, target[i-len(source)])
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(target) != targetLength {
+		return nil, errors.New(i18n.T("VCDIFF 目标窗口长度与声明的长度不一致"))
+	}
+	if checksum != nil && adler32.Checksum(target) != binary.BigEndian.Uint32(checksum) {
+		return nil, errors.New(i18n.T("VCDIFF 目标窗口校验和不一致"))
+	}
+	return append(out, target...), nil
+}
+
+func init() {
+	Register(VcDiff{})
+}
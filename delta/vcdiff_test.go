@@ -0,0 +1,252 @@
+package delta
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/adler32"
+	"math/rand"
+	"testing"
+)
+
+func vcdTestInputs() map[string][2][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+	base := random(200000)
+	edited := append([]byte(nil), base...)
+	for i := 0; i < 100; i++ {
+		edited[rng.Intn(len(edited))] = byte(rng.Intn(256))
+	}
+	edited = append(edited[:50000], append(random(3000), edited[50000:]...)...)
+	edited = append(edited[:120000:120000], edited[130000:]...)
+	moved := append(append([]byte(nil), base[100000:]...), base[:100000]...)
+	periodic := bytes.Repeat([]byte("abcdefghijklmnopq"), 5000)
+	runs := append(append(bytes.Repeat([]byte{0}, 10000), random(100)...), bytes.Repeat([]byte{0xFF}, 10000)...)
+
+	return map[string][2][]byte{
+		"都为空":      {nil, nil},
+		"旧版为空":     {nil, random(1000)},
+		"新版为空":     {random(1000), nil},
+		"一个字节":     {{1}, {2}},
+		"相同":       {base, base},
+		"随机修改":     {base, edited},
+		"移动数据块":    {base, moved},
+		"不相关":      {random(5000), random(5000)},
+		"周期数据":     {periodic[:40000], periodic},
+		"连续相同字节":   {random(1000), runs},
+		"短于一个块":    {[]byte("hello"), []byte("hello world")},
+		"新版引用自身数据": {random(100), append(bytes.Repeat(random(100), 50), 1)},
+	}
+}
+
+func TestVcDiffRoundTrip(t *testing.T) {
+	for name, input := range vcdTestInputs() {
+		t.Run(name, func(t *testing.T) {
+			oldBytes, newBytes := input[0], input[1]
+			diffBytes, err := VcDiff{}.Diff(context.Background(), oldBytes, newBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patched, err := VcDiff{}.Patch(oldBytes, diffBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(patched, newBytes) {
+				t.Fatalf("还原结果与新版数据不一致，长度 %d，期望 %d", len(patched), len(newBytes))
+			}
+		})
+	}
+}
+
+func TestVcDiffSize(t *testing.T) {
+	inputs := vcdTestInputs()
+	for _, name := range []string{"相同", "随机修改", "移动数据块", "周期数据", "连续相同字节"} {
+		oldBytes, newBytes := inputs[name][0], inputs[name][1]
+		diffBytes, err := VcDiff{}.Diff(context.Background(), oldBytes, newBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diffBytes) > len(newBytes)/10 {
+			t.Errorf("%s：差异数据 %d 字节，新版数据 %d 字节", name, len(diffBytes), len(newBytes))
+		}
+	}
+}
+
+// vcdTestWindow 按 RFC 3284 4.2 节组装一个窗口，带 xdelta3 的 VCD_ADLER32 扩展
+func vcdTestWindow(sourceLength, sourcePosition int, target, data, instructions, addresses []byte) []byte {
+	var delta []byte
+	delta = appendVarint(delta, len(target))
+	delta = append(delta, 0)
+	delta = appendVarint(delta, len(data))
+	delta = appendVarint(delta, len(instructions))
+	delta = appendVarint(delta, len(addresses))
+	delta = binary.BigEndian.AppendUint32(delta, adler32.Checksum(target))
+	delta = append(delta, data...)
+	delta = append(delta, instructions...)
+	delta = append(delta, addresses...)
+
+	window := []byte{vcdWindowIndicatorSource | vcdWindowIndicatorAdler32}
+	window = appendVarint(window, sourceLength)
+	window = appendVarint(window, sourcePosition)
+	window = appendVarint(window, len(delta))
+	return append(window, delta...)
+}
+
+// vcdTestXdelta3Patch 是手工组装的差异文件，使用 xdelta3 -S none 输出中会出现而 VcDiff.Diff 不会生成的结构：
+// 应用程序头、多个窗口、源数据段偏移、校验和、跨越源数据段和目标窗口的复制、NEAR 和 SAME 地址模式
+func vcdTestXdelta3Patch() (oldBytes, newBytes, diffBytes []byte) {
+	oldBytes = []byte("The quick brown fox jumps over the lazy dog.\n")
+	target1 := []byte("The quick brown cat jumps over the lazy dog.\n")
+	target2 := []byte("The quick brown cat!\ncat!\n--------\n")
+	target3 := []byte("dog.\ndog.\ndog.\n")
+	newBytes = append(append(append([]byte(nil), target1...), target2...), target3...)
+
+	diffBytes = append([]byte(nil), vcdMagic...)
+	diffBytes = append(diffBytes, vcdHeaderIndicatorAppHeader)
+	appHeader := []byte("new.txt//old.txt/")
+	diffBytes = appendVarint(diffBytes, len(appHeader))
+	diffBytes = append(diffBytes, appHeader...)
+
+	// 窗口 1，源数据段为整个旧版数据
+	diffBytes = append(diffBytes, vcdTestWindow(len(oldBytes), 0, target1,
+		[]byte("cat"),
+		[]byte{
+			32,     // COPY 16 SELF
+			4,      // ADD 3
+			51, 26, // COPY 26 NEAR[0]
+		},
+		[]byte{
+			0,  // 地址 0
+			19, // NEAR[0] 为 0，地址 19
+		},
+	)...)
+
+	// 窗口 2，源数据段为旧版数据的 "quick brown "
+	diffBytes = append(diffBytes, vcdTestWindow(12, 4, target2,
+		[]byte("The cat!\n-\n"),
+		[]byte{
+			5,    // ADD 4
+			124,  // COPY 12 SAME[0]
+			6,    // ADD 5
+			37,   // COPY 5 HERE
+			0, 8, // RUN 8
+			2, // ADD 1
+		},
+		[]byte{
+			0, // SAME[0] 中的地址 0
+			5, // 当前位置 33，地址 28，即目标窗口中的 "cat!\n"
+		},
+	)...)
+
+	// 窗口 3，源数据段为旧版数据的 "dog.\n"，复制从源数据段延伸到目标窗口
+	diffBytes = append(diffBytes, vcdTestWindow(5, 40, target3,
+		nil,
+		[]byte{
+			19, 15, // COPY 15 SELF
+		},
+		[]byte{
+			0, // 地址 0
+		},
+	)...)
+	return oldBytes, newBytes, diffBytes
+}
+
+func TestVcDiffPatchXdelta3Layout(t *testing.T) {
+	oldBytes, newBytes, diffBytes := vcdTestXdelta3Patch()
+	patched, err := VcDiff{}.Patch(oldBytes, diffBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(patched, newBytes) {
+		t.Fatalf("还原结果 %q，期望 %q", patched, newBytes)
+	}
+}
+
+func TestVcDiffPatchErrors(t *testing.T) {
+	oldBytes, _, diffBytes := vcdTestXdelta3Patch()
+
+	checksumMismatch := append([]byte(nil), diffBytes...)
+	checksumMismatch[len(checksumMismatch)-4] ^= 1
+
+	secondaryCompression := append([]byte(nil), diffBytes...)
+	secondaryCompression[len(vcdMagic)] |= vcdHeaderIndicatorDecompress
+
+	tests := map[string][]byte{
+		"不是 VCDIFF": []byte("BSDIFF40"),
+		"数据不完整":     diffBytes[:len(diffBytes)-1],
+		"校验和不一致":    checksumMismatch,
+		"二级压缩":      secondaryCompression,
+	}
+	for name, diffBytes := range tests {
+		if _, err := (VcDiff{}).Patch(oldBytes, diffBytes); err == nil {
+			t.Errorf("%s：没有返回错误", name)
+		}
+	}
+	if _, err := (VcDiff{}).Patch(oldBytes[:30], diffBytes); err == nil {
+		t.Errorf("源数据段超出旧版数据：没有返回错误")
+	}
+}
+
+// 截断的差异文件返回错误，不会 panic，在窗口之间截断时只能还原出前面的窗口
+func TestVcDiffPatchTruncated(t *testing.T) {
+	oldBytes, newBytes, diffBytes := vcdTestXdelta3Patch()
+	for n := 0; n < len(diffBytes); n++ {
+		patched, err := VcDiff{}.Patch(oldBytes, diffBytes[:n])
+		if err == nil && (len(patched) >= len(newBytes) || !bytes.HasPrefix(newBytes, patched)) {
+			t.Errorf("截断为 %d 字节：没有返回错误，还原结果 %q", n, patched)
+		}
+	}
+}
+
+// 窗口头中的长度来自差异文件，过大或相加溢出时返回错误，不会 panic 或分配过多内存
+func TestVcDiffPatchGarbageHeader(t *testing.T) {
+	oldBytes := []byte("The quick brown fox jumps over the lazy dog.\n")
+	header := append(append([]byte(nil), vcdMagic...), 0)
+	window := func(sourceLength, sourcePosition int, delta []byte) []byte {
+		w := append([]byte(nil), header...)
+		w = append(w, vcdWindowIndicatorSource)
+		w = appendVarint(w, sourceLength)
+		w = appendVarint(w, sourcePosition)
+		w = appendVarint(w, len(delta))
+		return append(w, delta...)
+	}
+	// delta 组装窗口的数据部分，指令为 RUN size
+	delta := func(targetLength, size int) []byte {
+		instructions := appendVarint([]byte{0}, size)
+		d := appendVarint(nil, targetLength)
+		d = append(d, 0)
+		d = appendVarint(d, 1)
+		d = appendVarint(d, len(instructions))
+		d = appendVarint(d, 0)
+		d = append(d, 'x')
+		return append(d, instructions...)
+	}
+	const huge = 1<<63 - 1
+	tests := map[string][]byte{
+		"源数据段长度过大":        window(huge, 0, delta(1, 1)),
+		"源数据段位置过大":        window(1, huge, delta(1, 1)),
+		"源数据段位置加长度溢出":     window(2, huge-1, delta(1, 1)),
+		"目标窗口长度过大":        window(0, 0, delta(huge, 1)),
+		"目标窗口长度超过上限":      window(0, 0, delta(vcdMaxTargetLength+1, 1)),
+		"指令长度加目标窗口长度溢出":   window(0, 0, delta(2, huge)),
+		"指令长度超过声明的目标窗口长度": window(0, 0, delta(2, 3)),
+		"窗口头不完整":          window(0, 0, delta(1, 1))[:len(header)+3],
+	}
+	for name, diffBytes := range tests {
+		if _, err := (VcDiff{}).Patch(oldBytes, diffBytes); err == nil {
+			t.Errorf("%s：没有返回错误", name)
+		}
+	}
+	// 构造正确时可以还原，说明上面的错误来自被修改的字段
+	patched, err := VcDiff{}.Patch(oldBytes, window(0, 0, delta(3, 3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(patched) != "xxx" {
+		t.Fatalf("还原结果 %q", patched)
+	}
+}
@@ -0,0 +1,437 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ganlvtech/go-dir-bsdiff/delta"
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+const (
+	// AutoCodecName 表示尝试全部差异算法和压缩算法
+	AutoCodecName = "auto"
+	// NoCompressionName 表示新文件数据不压缩
+	NoCompressionName = "none"
+)
+
+type Options struct {
+	// Codecs 是参与比较的差异算法
+	Codecs []delta.Codec
+	// Compressors 是参与比较的新文件数据压缩算法
+	Compressors []delta.Compressor
+	// Compression 是保存新文件数据时使用的压缩算法，为 nil 时不压缩
+	Compression delta.Compressor
+	// ZstdLevel 是 zstd 命令行的压缩等级
+	ZstdLevel int
+	// PatchFromSize 大于 0 时，旧文件或新文件不小于这个大小的文件使用 patch-from 模式
+	PatchFromSize int64
+	// AdaptiveChunks 为 true 时 Generate 的 bulkSize 是最大分块大小，每个文件的分块大小由 AdaptiveBulkSize 决定
+	AdaptiveChunks bool
+}
+
+// PatchMemoryFactor 是应用一块 bsdiff 补丁需要的内存与分块大小的大致比例，同时在内存中的有旧文件块、差异文件和新文件块
+const PatchMemoryFactor = 3
+
+// AdaptiveBulkSize 返回文件的分块大小，maxBulkSize 是应用补丁的机器的内存预算允许的最大分块大小
+//
+// 旧文件和新文件都不超过 maxBulkSize 的文件不分块，更大的文件平均分成最少的块，每块不超过 maxBulkSize，避免最后一块很小
+func AdaptiveBulkSize(maxBulkSize int, oldFileSize, newFileSize int64) int {
+	fileSize := max(oldFileSize, newFileSize)
+	if fileSize <= int64(maxBulkSize) {
+		return maxBulkSize
+	}
+	parts := (fileSize + int64(maxBulkSize) - 1) / int64(maxBulkSize)
+	return int((fileSize + parts - 1) / parts)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteNewData 保存新文件数据，options.Compression 不为 nil 时边读取边压缩
+//
+// 返回操作、读取的字节数和保存的字节数。出错或 ctx 取消时删除写了一半的文件
+func WriteNewData(ctx context.Context, options *Options, diffNewBasePath string, r io.Reader) (operation patch.PartOperation, bytesRead int64, bytesWritten int64, err error) {
+	operation = patch.PartOperation{Type: patch.OperationTypeCopyNew}
+	r = util.NewContextReader(ctx, r)
+	if options.Compression == nil {
+		defer util.RemoveOnError(diffNewBasePath, &err)
+		n, err := util.WriteAll(diffNewBasePath, r)
+		return operation, n, n, err
+	}
+	operation.Argument = options.Compression.Name()
+	diffNewFilePath := patch.GetNewFileName(diffNewBasePath, operation.Argument)
+	out, err := os.OpenFile(diffNewFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return operation, 0, 0, err
+	}
+	defer out.Close()
+	defer util.RemoveOnError(diffNewFilePath, &err)
+	w, err := options.Compression.NewWriter(out)
+	if err != nil {
+		return operation, 0, 0, err
+	}
+	counter := &countingReader{r: r}
+	buf := make([]byte, util.CopyBufferSize)
+	if _, err := io.CopyBuffer(w, counter, buf); err != nil {
+		w.Close()
+		return operation, 0, 0, err
+	}
+	if err := w.Close(); err != nil {
+		return operation, 0, 0, err
+	}
+	if err := out.Close(); err != nil {
+		return operation, 0, 0, err
+	}
+	size, err := util.GetFileSize(diffNewFilePath)
+	if err != nil {
+		return operation, 0, 0, err
+	}
+	return operation, counter.n, size, nil
+}
+
+// DoBsDiffPart 计算一块数据的差异，依次尝试 options.Codecs 中的差异算法和 options.Compressors 中的压缩算法，保留最小的结果，
+// 都不比新文件数据小时保存新文件数据，options.Compression 不为 nil 且能减小体积时压缩保存
+//
+// 差异文件和新文件数据的路径由 diffPartBasePath 加上后缀名得到，ctx 取消时正在执行的算法会尽快返回。
+// 新数据全部为 0 时返回 zero 操作，不计算差异
+func DoBsDiffPart(ctx context.Context, options *Options, oldBytes []byte, newBytes []byte, diffPartBasePath string) (string, int, error) {
+	if len(newBytes) > 0 && util.IsZero(newBytes) {
+		return patch.ZeroOperation(int64(len(newBytes))).String(), 0, nil
+	}
+	oldBytesMD5 := util.BytesMD5(oldBytes)
+	newBytesMD5 := util.BytesMD5(newBytes)
+	if oldBytesMD5 == newBytesMD5 {
+		return patch.OperationTypeCopyOld, 0, nil
+	}
+	best := patch.PartOperation{Type: patch.OperationTypeCopyNew}
+	bestBytes := newBytes
+	if options.Compression != nil {
+		compressedBytes, err := delta.CompressBytes(ctx, options.Compression, newBytes)
+		if err != nil && err == ctx.Err() {
+			return "", 0, err
+		} else if err != nil {
+			return "", 0, fmt.Errorf(i18n.T("执行 %s 压缩错误：%w"), options.Compression.Name(), err)
+		}
+		if len(compressedBytes) < len(bestBytes) {
+			best = patch.PartOperation{Type: patch.OperationTypeCopyNew, Argument: options.Compression.Name()}
+			bestBytes = compressedBytes
+		}
+	}
+	for _, codec := range options.Codecs {
+		diffBytes, err := codec.Diff(ctx, oldBytes, newBytes)
+		if err != nil && err == ctx.Err() {
+			return "", 0, err
+		} else if err != nil {
+			return "", 0, fmt.Errorf(i18n.T("执行 %s 错误：%w"), codec.Name(), err)
+		}
+		if len(diffBytes) < len(bestBytes) || len(diffBytes) == len(bestBytes) && best.Type == patch.OperationTypeCopyNew {
+			best = patch.PartOperation{Type: patch.OperationTypePatch, Argument: codec.Name()}
+			bestBytes = diffBytes
+		}
+	}
+	for _, compressor := range options.Compressors {
+		compressedBytes, err := delta.CompressBytes(ctx, compressor, newBytes)
+		if err != nil && err == ctx.Err() {
+			return "", 0, err
+		} else if err != nil {
+			return "", 0, fmt.Errorf(i18n.T("执行 %s 压缩错误：%w"), compressor.Name(), err)
+		}
+		if len(compressedBytes) < len(bestBytes) {
+			best = patch.PartOperation{Type: patch.OperationTypeCopyNew, Argument: compressor.Name()}
+			bestBytes = compressedBytes
+		}
+	}
+	if best.Type == patch.OperationTypePatch {
+		err := ioutil.WriteFile(patch.GetDiffFileName(diffPartBasePath, best.Argument), bestBytes, 0644)
+		if err != nil {
+			return "", 0, fmt.Errorf(i18n.T("写入差异文件错误：%w"), err)
+		}
+	} else {
+		err := ioutil.WriteFile(patch.GetNewFileName(diffPartBasePath, best.Argument), bestBytes, 0644)
+		if err != nil {
+			return "", 0, fmt.Errorf(i18n.T("复制文件错误：%w"), err)
+		}
+	}
+	return best.String(), len(bestBytes), nil
+}
+
+// DoBsDiff 计算文件的差异，文件大于 bulkSize 时分块计算，每块开始前检查 ctx 是否已取消
+//
+// 新文件超出旧文件的部分也按 bulkSize 分块保存新文件数据，全部为 0 的块记录为 zero 操作
+func DoBsDiff(ctx context.Context, options *Options, oldFilePath, newFilePath, diffFileBasePath string, bulkSize int) (string, int, error) {
+	oldFileSize, err := util.GetFileSize(oldFilePath)
+	if err != nil {
+		return "", 0, fmt.Errorf(i18n.T("获取旧版文件大小错误：%w"), err)
+	}
+	newFileSize, err := util.GetFileSize(newFilePath)
+	if err != nil {
+		return "", 0, fmt.Errorf(i18n.T("获取新版文件大小错误：%w"), err)
+	}
+	oldFileReader, err := os.Open(oldFilePath)
+	if err != nil {
+		return "", 0, fmt.Errorf(i18n.T("打开旧版文件错误：%w"), err)
+	}
+	defer oldFileReader.Close()
+	newFileReader, err := os.Open(newFilePath)
+	if err != nil {
+		return "", 0, fmt.Errorf(i18n.T("打开新版文件错误：%w"), err)
+	}
+	defer newFileReader.Close()
+	return doBsDiff(ctx, options, oldFileReader, newFileReader, oldFileSize, newFileSize, diffFileBasePath, bulkSize)
+}
+
+// readChunk 与 patch.ReadPart 相同，读满 buf 或者读到文件末尾，只有没有读到数据时返回 io.EOF
+//
+// 一次 Read 不一定能读满 buf，Linux 上一次最多读取 0x7ffff000 字节，只读一次会使这一块和之后的块都与应用补丁时不一致
+func readChunk(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// bsDiffBuffers 返回读取旧文件块和新文件块的缓冲区，-memory-budget 时 bulkSize 可能远大于文件
+//
+// 不分块时缓冲区就是文件大小。分块时不超过文件大小，至少 1 字节，读取空文件时才会返回 io.EOF
+func bsDiffBuffers(bulkSize int, oldFileSize, newFileSize int64) ([]byte, []byte) {
+	if oldFileSize <= int64(bulkSize) && newFileSize <= int64(bulkSize) {
+		return make([]byte, oldFileSize), make([]byte, newFileSize)
+	}
+	return make([]byte, min(int64(bulkSize), max(oldFileSize, 1))), make([]byte, min(int64(bulkSize), max(newFileSize, 1)))
+}
+
+// doBsDiff 按 DoBsDiff 的方式计算 oldFileReader 和 newFileReader 的差异
+func doBsDiff(ctx context.Context, options *Options, oldFileReader, newFileReader io.Reader, oldFileSize, newFileSize int64, diffFileBasePath string, bulkSize int) (string, int, error) {
+	if oldFileSize <= int64(bulkSize) && newFileSize <= int64(bulkSize) {
+		oldBytes, newBytes := bsDiffBuffers(bulkSize, oldFileSize, newFileSize)
+		oldBytesRead, err := readChunk(oldFileReader, oldBytes)
+		if err != nil {
+			if err != io.EOF {
+				return "", 0, fmt.Errorf(i18n.T("读取旧版文件错误：%w"), err)
+			}
+		}
+		newBytesRead, err := readChunk(newFileReader, newBytes)
+		if err != nil {
+			if err != io.EOF {
+				return "", 0, fmt.Errorf(i18n.T("读取新版文件错误：%w"), err)
+			}
+		}
+		return DoBsDiffPart(ctx, options, oldBytes[:oldBytesRead], newBytes[:newBytesRead], diffFileBasePath)
+	} else {
+		oldBytes, newBytes := bsDiffBuffers(bulkSize, oldFileSize, newFileSize)
+		partIndex := 1
+		oldFileFinished := false
+		newFileFinished := false
+		oldBytesReadSum := 0
+		newBytesReadSum := 0
+		resultParts := make([]string, 0)
+		resultSize := 0
+		for !oldFileFinished && !newFileFinished {
+			if err := ctx.Err(); err != nil {
+				return "", 0, err
+			}
+			oldBytesRead, err := readChunk(oldFileReader, oldBytes)
+			if err != nil {
+				if err != io.EOF {
+					return "", 0, fmt.Errorf(i18n.T("读取旧版文件错误：%w"), err)
+				}
+				oldFileFinished = true
+				break
+			}
+			oldBytesReadSum += oldBytesRead
+			if oldBytesReadSum >= int(oldFileSize) {
+				oldFileFinished = true
+			}
+			newBytesRead, err := readChunk(newFileReader, newBytes)
+			if err != nil {
+				if err != io.EOF {
+					return "", 0, fmt.Errorf(i18n.T("读取新版文件错误：%w"), err)
+				}
+				newFileFinished = true
+				break
+			}
+			newBytesReadSum += newBytesRead
+			if newBytesReadSum >= int(newFileSize) {
+				newFileFinished = true
+			}
+			diffPartBasePath := patch.GetPartNewFileName(diffFileBasePath, partIndex)
+			result, diffByteSize, err := DoBsDiffPart(ctx, options, oldBytes[:oldBytesRead], newBytes[:newBytesRead], diffPartBasePath)
+			if err != nil {
+				return "", 0, fmt.Errorf(i18n.T("第 %d 块文件计算差异错误：%w"), partIndex, err)
+			}
+			resultParts = append(resultParts, result)
+			resultSize += diffByteSize
+			partIndex++
+		}
+		for !newFileFinished {
+			if err := ctx.Err(); err != nil {
+				return "", 0, err
+			}
+			newBytesRead, err := io.ReadFull(newFileReader, newBytes)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				newFileFinished = true
+			} else if err != nil {
+				return "", 0, fmt.Errorf(i18n.T("读取新版文件错误：%w"), err)
+			}
+			if newBytesRead == 0 {
+				break
+			}
+			if util.IsZero(newBytes[:newBytesRead]) {
+				resultParts = append(resultParts, patch.ZeroOperation(int64(newBytesRead)).String())
+				partIndex++
+				continue
+			}
+			partFilePath := patch.GetPartNewFileName(diffFileBasePath, partIndex)
+			result, _, diffByteSize, err := WriteNewData(ctx, options, partFilePath, bytes.NewReader(newBytes[:newBytesRead]))
+			if err != nil {
+				return "", 0, fmt.Errorf(i18n.T("写入第 %d 块文件错误：%w"), partIndex, err)
+			}
+			resultParts = append(resultParts, result.String())
+			resultSize += int(diffByteSize)
+			partIndex++
+		}
+		return strings.Join(resultParts, patch.PartOperationSeparator), resultSize, nil
+	}
+}
+
+// DoPatchFrom 以旧文件为字典用 zstd 压缩新文件，结果不比新文件小时改为直接保存新文件
+func DoPatchFrom(ctx context.Context, options *Options, oldFilePath, newFilePath, diffFileBasePath string) (result string, err error) {
+	oldBytes, err := ioutil.ReadFile(oldFilePath)
+	if err != nil {
+		return "", fmt.Errorf(i18n.T("读取旧版文件错误：%w"), err)
+	}
+	newFileSize, err := util.GetFileSize(newFilePath)
+	if err != nil {
+		return "", fmt.Errorf(i18n.T("获取新版文件大小错误：%w"), err)
+	}
+	newFileReader, err := os.Open(newFilePath)
+	if err != nil {
+		return "", fmt.Errorf(i18n.T("打开新版文件错误：%w"), err)
+	}
+	defer newFileReader.Close()
+	diffFilePath := patch.GetPatchFromFileName(diffFileBasePath)
+	diffFileWriter, err := os.OpenFile(diffFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", fmt.Errorf(i18n.T("创建差异文件错误：%w"), err)
+	}
+	defer diffFileWriter.Close()
+	defer util.RemoveOnError(diffFilePath, &err)
+	err = delta.ZstdPatchFromDiff(oldBytes, util.NewContextReader(ctx, newFileReader), newFileSize, diffFileWriter, options.ZstdLevel)
+	if err != nil {
+		return "", fmt.Errorf(i18n.T("执行 zstd patch-from 错误：%w"), err)
+	}
+	if err := diffFileWriter.Close(); err != nil {
+		return "", fmt.Errorf(i18n.T("写入差异文件错误：%w"), err)
+	}
+	diffFileSize, err := util.GetFileSize(diffFilePath)
+	if err != nil {
+		return "", fmt.Errorf(i18n.T("获取差异文件大小错误：%w"), err)
+	}
+	if diffFileSize < newFileSize {
+		return patch.OperationTypePatchFrom, nil
+	}
+	if err := os.Remove(diffFilePath); err != nil {
+		return "", fmt.Errorf(i18n.T("删除差异文件错误：%w"), err)
+	}
+	return CopyNewFile(ctx, options, diffFileBasePath, newFilePath)
+}
+
+// UsePatchFrom 判断文件是否使用 patch-from 模式
+func UsePatchFrom(options *Options, oldFilePath, newFilePath string) (bool, error) {
+	if options.PatchFromSize <= 0 {
+		return false, nil
+	}
+	oldFileSize, err := util.GetFileSize(oldFilePath)
+	if err != nil {
+		return false, err
+	}
+	newFileSize, err := util.GetFileSize(newFilePath)
+	if err != nil {
+		return false, err
+	}
+	return oldFileSize >= options.PatchFromSize || newFileSize >= options.PatchFromSize, nil
+}
+
+// CopyNewFile 把新增文件复制到差异文件夹，options.Compression 不为 nil 时压缩保存，文件全部为 0 时返回 zero 操作，不复制
+func CopyNewFile(ctx context.Context, options *Options, diffNewFilePath, newFilePath string) (string, error) {
+	isZero, size, err := util.IsZeroFile(newFilePath)
+	if err != nil {
+		return "", err
+	}
+	if isZero && size > 0 {
+		return patch.ZeroOperation(size).String(), nil
+	}
+	if options.Compression == nil {
+		return patch.OperationTypeCopyNew, util.CopyFileContext(ctx, diffNewFilePath, newFilePath)
+	}
+	newFileReader, err := os.Open(newFilePath)
+	if err != nil {
+		return "", err
+	}
+	defer newFileReader.Close()
+	result, _, _, err := WriteNewData(ctx, options, diffNewFilePath, newFileReader)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// NewOptions 返回参与比较的差异算法和压缩算法，auto 表示尝试全部已注册的算法
+func NewOptions(codecName string, compressionName string, zstdLevel int, patchFromSize int64) (*Options, error) {
+	options := &Options{ZstdLevel: zstdLevel, PatchFromSize: patchFromSize}
+	if compressionName != NoCompressionName {
+		compressor, err := delta.GetCompressor(compressionName)
+		if err != nil {
+			return nil, err
+		}
+		options.Compression = options.withZstdLevel(compressor)
+	}
+	if codecName != AutoCodecName {
+		codec, err := delta.Get(codecName)
+		if err != nil {
+			return nil, err
+		}
+		options.Codecs = []delta.Codec{codec}
+		return options, nil
+	}
+	for _, name := range delta.Names() {
+		codec, err := delta.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		options.Codecs = append(options.Codecs, codec)
+	}
+	for _, name := range delta.CompressorNames() {
+		compressor, err := delta.GetCompressor(name)
+		if err != nil {
+			return nil, err
+		}
+		options.Compressors = append(options.Compressors, options.withZstdLevel(compressor))
+	}
+	return options, nil
+}
+
+// withZstdLevel 把已注册的 zstd 压缩算法换成使用 options.ZstdLevel 的，不修改全局注册的算法
+func (options *Options) withZstdLevel(compressor delta.Compressor) delta.Compressor {
+	if _, ok := compressor.(delta.Zstd); ok {
+		return delta.Zstd{Level: options.ZstdLevel}
+	}
+	return compressor
+}
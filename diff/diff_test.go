@@ -0,0 +1,134 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ganlvtech/go-dir-bsdiff/delta"
+	"github.com/ganlvtech/go-dir-bsdiff/internal/testutil"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+// 一次 Read 只返回一部分数据时，每一块仍然是完整的 bulkSize，结果与一次读满相同
+func TestDoBsDiffShortRead(t *testing.T) {
+	const bulkSize = 64 << 10
+	rng := rand.New(rand.NewSource(1))
+	oldBytes := testutil.RandomBytes(rng, 3*bulkSize+1000)
+	newBytes := append([]byte(nil), oldBytes...)
+	for i := 0; i < 4; i++ {
+		copy(newBytes[i*bulkSize+500:], "edited")
+	}
+	newBytes = append(newBytes, testutil.RandomBytes(rng, 2*bulkSize+500)...)
+
+	run := func(wrap func(io.Reader) io.Reader) (string, map[string][]byte) {
+		t.Helper()
+		diffDir := t.TempDir()
+		result, _, err := doBsDiff(context.Background(), newOptions(t), wrap(bytes.NewReader(oldBytes)), wrap(bytes.NewReader(newBytes)), int64(len(oldBytes)), int64(len(newBytes)), filepath.Join(diffDir, "a.bin"), bulkSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(diffDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloads := make(map[string][]byte)
+		for _, entry := range entries {
+			if payloads[entry.Name()], err = os.ReadFile(filepath.Join(diffDir, entry.Name())); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return result, payloads
+	}
+	wantResult, wantPayloads := run(func(r io.Reader) io.Reader { return r })
+	gotResult, gotPayloads := run(iotest.HalfReader)
+	if gotResult != wantResult {
+		t.Fatalf("操作为 %s，期望 %s", gotResult, wantResult)
+	}
+	if len(gotPayloads) != len(wantPayloads) {
+		t.Fatalf("差异文件数量 %d，期望 %d", len(gotPayloads), len(wantPayloads))
+	}
+	for name, want := range wantPayloads {
+		if !bytes.Equal(gotPayloads[name], want) {
+			t.Errorf("%s 与一次读满时不同", name)
+		}
+	}
+}
+
+func TestBsDiffBuffers(t *testing.T) {
+	tests := []struct {
+		bulkSize                     int
+		oldFileSize, newFileSize     int64
+		wantOldLength, wantNewLength int
+	}{
+		{1 << 30, 10000, 20000, 10000, 20000},
+		{1 << 30, 0, 0, 0, 0},
+		{1000, 1000, 1000, 1000, 1000},
+		{1000, 5000, 300, 1000, 300},
+		{1000, 0, 5000, 1, 1000},
+	}
+	for _, test := range tests {
+		oldBytes, newBytes := bsDiffBuffers(test.bulkSize, test.oldFileSize, test.newFileSize)
+		if len(oldBytes) != test.wantOldLength || len(newBytes) != test.wantNewLength {
+			t.Errorf("bsDiffBuffers(%d, %d, %d) 的长度为 %d、%d，期望 %d、%d", test.bulkSize, test.oldFileSize, test.newFileSize, len(oldBytes), len(newBytes), test.wantOldLength, test.wantNewLength)
+		}
+	}
+}
+
+// 分块大小远大于文件时不分块，生成的补丁可以正确应用
+func TestGenerateLargeBulkSize(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := testutil.RandomBytes(rng, 100000)
+	edited := append([]byte(nil), base...)
+	copy(edited[5000:], "edited")
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	diffDir := filepath.Join(root, "diff")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"a.bin": base, "empty.bin": nil})
+	testutil.WriteFiles(t, newDir, map[string][]byte{"a.bin": edited, "empty.bin": nil, "b.bin": testutil.RandomBytes(rng, 1000)})
+
+	manifest := generate(t, newOptions(t), oldDir, newDir, diffDir, 1<<30)
+	if op := patch.ParseOperation(manifest.Patches["a.bin"]); len(op) != 1 || op[0].Type != patch.OperationTypePatch {
+		t.Errorf("a.bin 的操作为 %s", manifest.Patches["a.bin"])
+	}
+	patchedDir := filepath.Join(root, "patched")
+	if err := patch.Apply(context.Background(), oldDir, patchedDir, diffDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertSameDir(t, newDir, patchedDir)
+}
+
+// 不同的选项使用各自的 zstd 压缩等级，不修改全局注册的压缩算法
+func TestNewOptionsZstdLevel(t *testing.T) {
+	fast, err := NewOptions(AutoCodecName, delta.ZstdName, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	best, err := NewOptions(AutoCodecName, delta.ZstdName, 19, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []*Options{fast, best} {
+		if got := options.Compression.(delta.Zstd).Level; got != options.ZstdLevel {
+			t.Errorf("Compression 的压缩等级为 %d，期望 %d", got, options.ZstdLevel)
+		}
+		for _, compressor := range options.Compressors {
+			if zstd, ok := compressor.(delta.Zstd); ok && zstd.Level != options.ZstdLevel {
+				t.Errorf("Compressors 中 zstd 的压缩等级为 %d，期望 %d", zstd.Level, options.ZstdLevel)
+			}
+		}
+	}
+	registered, err := delta.GetCompressor(delta.ZstdName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.(delta.Zstd).Level != 0 {
+		t.Errorf("全局注册的 zstd 压缩等级被修改为 %d", registered.(delta.Zstd).Level)
+	}
+}
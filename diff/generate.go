@@ -0,0 +1,259 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+// Generate 根据旧版和新版文件夹的扫描结果生成从旧版更新到新版的差异文件夹和补丁描述文件
+//
+// 交换旧版和新版的参数即可生成反向补丁，不需要重新扫描文件夹
+//
+// store 不为 nil 时差异文件移动到共用的存储中，已经保存过的新增文件不再复制
+//
+// 每个文件开始前检查 ctx，取消后返回 ctx 的错误，不生成补丁描述文件
+func Generate(ctx context.Context, diffOptions *Options, oldDirAbsPath, newDirAbsPath, diffDirAbsPath string, oldScan, newScan *util.DirScanResult, bulkSize int, symlinkPolicy patch.SymlinkPolicy, store *PayloadStore) error {
+	oldFilesMD5 := oldScan.Files
+	newFilesMD5 := newScan.Files
+
+	log.Println()
+	log.Println(i18n.T("正在列举未修改和新增文件"))
+	notModifiedFiles := make([]string, 0)
+	addFiles := make([]string, 0)
+	patchFiles := make([]string, 0)
+	for fileName, fileMD5 := range newFilesMD5 {
+		if oldFileMD5, ok := oldFilesMD5[fileName]; ok {
+			if oldFileMD5 == fileMD5 {
+				notModifiedFiles = append(notModifiedFiles, fileName)
+			} else {
+				patchFiles = append(patchFiles, fileName)
+			}
+		} else {
+			addFiles = append(addFiles, fileName)
+		}
+	}
+
+	log.Println()
+	log.Println(i18n.T("差异文件列表"))
+	sort.Strings(notModifiedFiles)
+	sort.Strings(addFiles)
+	sort.Strings(patchFiles)
+	for _, fileName := range notModifiedFiles {
+		log.Println(" ", newFilesMD5[fileName], fileName)
+	}
+	for _, fileName := range addFiles {
+		log.Println("+", newFilesMD5[fileName], fileName)
+	}
+	for _, fileName := range patchFiles {
+		log.Println("*", newFilesMD5[fileName], fileName)
+	}
+
+	log.Println()
+	log.Println(i18n.T("符号链接列表"))
+	symlinks := make(map[string]string)
+	symlinkNames := make([]string, 0, len(newScan.Symlinks))
+	for linkName := range newScan.Symlinks {
+		symlinkNames = append(symlinkNames, linkName)
+	}
+	sort.Strings(symlinkNames)
+	for _, linkName := range symlinkNames {
+		target := newScan.Symlinks[linkName]
+		if util.SymlinkEscapesRoot(newDirAbsPath, linkName, target) {
+			switch symlinkPolicy {
+			case patch.SymlinkPolicySkip:
+				log.Println(i18n.T("跳过指向文件夹之外的符号链接"), linkName, "->", target)
+				continue
+			case patch.SymlinkPolicyError:
+				return fmt.Errorf(i18n.T("符号链接指向文件夹之外：%s -> %s"), linkName, target)
+			}
+		}
+		if oldTarget, ok := oldScan.Symlinks[linkName]; !ok {
+			log.Println("+", linkName, "->", target)
+		} else if oldTarget != target {
+			log.Println("*", linkName, "->", target)
+		} else {
+			log.Println(" ", linkName, "->", target)
+		}
+		symlinks[linkName] = target
+	}
+
+	log.Println()
+	log.Println(i18n.T("文件夹列表"))
+	dirs := make([]string, 0, len(newScan.Dirs))
+	for dirName := range newScan.Dirs {
+		dirs = append(dirs, dirName)
+	}
+	sort.Strings(dirs)
+	for _, dirName := range dirs {
+		if oldScan.Dirs[dirName] {
+			log.Println(" ", dirName)
+		} else {
+			log.Println("+", dirName)
+		}
+	}
+	removedDirs := make([]string, 0)
+	for dirName := range oldScan.Dirs {
+		if !newScan.Dirs[dirName] {
+			removedDirs = append(removedDirs, dirName)
+		}
+	}
+	sort.Strings(removedDirs)
+	for _, dirName := range removedDirs {
+		log.Println("-", dirName)
+	}
+
+	patchManifest := patch.NewPatchManifest(bulkSize)
+	patchManifest.NewMd5 = make(map[string]string)
+	patchManifest.OldMd5 = make(map[string]string)
+	patchManifest.Patches = make(map[string]string)
+	patchManifest.Symlinks = symlinks
+	patchManifest.Dirs = dirs
+	patchManifest.RemovedDirs = removedDirs
+	patchManifest.OldHash = util.TreeMD5(oldFilesMD5)
+	patchManifest.NewHash = util.TreeMD5(newFilesMD5)
+	patchManifest.BulkSizes = make(map[string]int)
+	if store != nil {
+		patchManifest.Payloads = make(map[string]string)
+	}
+
+	log.Println()
+	log.Println(i18n.T("正在复制新文件"))
+
+	for _, fileName := range addFiles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		compressionName := ""
+		if diffOptions.Compression != nil {
+			compressionName = diffOptions.Compression.Name()
+		}
+		if store != nil {
+			if object, ok := store.NewFileObject(newFilesMD5[fileName], compressionName); ok {
+				log.Println(fileName, i18n.T("新文件已在存储中"))
+				operation := patch.PartOperation{Type: patch.OperationTypeCopyNew, Argument: compressionName}
+				patchManifest.Patches[fileName] = operation.String()
+				patchManifest.NewMd5[fileName] = newFilesMD5[fileName]
+				patchManifest.Payloads[patch.GetPayloadKey(fileName, 0, operation)] = object
+				continue
+			}
+		}
+		newFilePath := filepath.Join(newDirAbsPath, fileName)
+		diffNewFilePath := filepath.Join(diffDirAbsPath, fileName)
+		diffNewFileDirPath := filepath.Dir(diffNewFilePath)
+		if mkdirResult, err := util.MkdirIfNotExists(diffNewFileDirPath); err != nil {
+			return fmt.Errorf(i18n.T("%s 创建文件夹失败：%w"), diffNewFileDirPath, err)
+		} else if mkdirResult == util.MkdirIfNotExistsResultExistsFile {
+			return fmt.Errorf(i18n.T("%s 路径存在，但不是文件夹"), diffNewFileDirPath)
+		} else if mkdirResult == util.MkdirIfNotExistsResultOK {
+			log.Println(i18n.T("创建文件夹成功"))
+		}
+		// 差异文件夹中已经存在的文件可能是上次生成的，内容和压缩算法不一定相同，总是重新写入
+		if diffNewFileInfoResult, _ := util.GetFileInfo(patch.GetNewFileName(diffNewFilePath, compressionName)); diffNewFileInfoResult == util.FileInfoResultExistDir {
+			return fmt.Errorf(i18n.T("%s 路径已存在，但不是文件"), diffNewFilePath)
+		}
+		result, err := CopyNewFile(ctx, diffOptions, diffNewFilePath, newFilePath)
+		if err != nil {
+			return fmt.Errorf(i18n.T("%s 复制新文件错误：%w"), fileName, err)
+		}
+		log.Println(fileName, i18n.T("复制成功"))
+		patchManifest.Patches[fileName] = result
+		patchManifest.NewMd5[fileName] = newFilesMD5[fileName]
+	}
+
+	log.Println()
+	log.Println(i18n.T("正在计算文件差异"))
+	for _, fileName := range patchFiles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		oldFilePath := filepath.Join(oldDirAbsPath, fileName)
+		newFilePath := filepath.Join(newDirAbsPath, fileName)
+		diffFileBasePath := filepath.Join(diffDirAbsPath, fileName)
+		diffNewFileDirPath := filepath.Dir(diffFileBasePath)
+		if mkdirResult, err := util.MkdirIfNotExists(diffNewFileDirPath); err != nil {
+			return fmt.Errorf(i18n.T("%s 创建文件夹失败：%w"), diffNewFileDirPath, err)
+		} else if mkdirResult == util.MkdirIfNotExistsResultExistsFile {
+			return fmt.Errorf(i18n.T("%s 路径存在，但不是文件夹"), diffNewFileDirPath)
+		} else if mkdirResult == util.MkdirIfNotExistsResultOK {
+			log.Println(diffNewFileDirPath, i18n.T("创建文件夹成功"))
+		}
+		usePatchFrom, err := UsePatchFrom(diffOptions, oldFilePath, newFilePath)
+		if err != nil {
+			return fmt.Errorf(i18n.T("%s 获取文件大小错误：%w"), fileName, err)
+		}
+		var result string
+		if usePatchFrom {
+			log.Println(fileName, i18n.T("正在使用 zstd patch-from 计算差异"))
+			result, err = DoPatchFrom(ctx, diffOptions, oldFilePath, newFilePath, diffFileBasePath)
+		} else {
+			log.Println(fileName, i18n.T("正在计算差异"))
+			fileBulkSize := bulkSize
+			if diffOptions.AdaptiveChunks {
+				fileBulkSize, err = adaptiveFileBulkSize(bulkSize, oldFilePath, newFilePath)
+				if err != nil {
+					return fmt.Errorf(i18n.T("%s 获取文件大小错误：%w"), fileName, err)
+				}
+				if fileBulkSize != bulkSize {
+					patchManifest.BulkSizes[fileName] = fileBulkSize
+				}
+			}
+			result, _, err = DoBsDiff(ctx, diffOptions, oldFilePath, newFilePath, diffFileBasePath, fileBulkSize)
+		}
+		if err != nil {
+			return fmt.Errorf(i18n.T("%s 计算文件差异错误：%w"), fileName, err)
+		}
+		log.Println(fileName, i18n.T("差异计算完成"))
+		if patch.UsesOldFile(patch.ParseOperation(result)) {
+			patchManifest.OldMd5[fileName] = oldFilesMD5[fileName]
+		}
+		patchManifest.Patches[fileName] = result
+		patchManifest.NewMd5[fileName] = newFilesMD5[fileName]
+	}
+
+	log.Println()
+	log.Println(i18n.T("正在生成补丁描述文件"))
+	for _, fileName := range notModifiedFiles {
+		patchManifest.OldMd5[fileName] = oldFilesMD5[fileName]
+		patchManifest.Patches[fileName] = patch.OperationTypeCopyOld
+	}
+	patchManifest.NewSize = make(map[string]int64, len(patchManifest.Patches))
+	for fileName := range patchManifest.Patches {
+		newFileSize, err := util.GetFileSize(filepath.Join(newDirAbsPath, fileName))
+		if err != nil {
+			return fmt.Errorf(i18n.T("%s 获取新版文件大小错误：%w"), fileName, err)
+		}
+		patchManifest.NewSize[fileName] = newFileSize
+	}
+	if store != nil {
+		log.Println(i18n.T("正在移动差异文件到存储"))
+		if err := store.Collect(patchManifest, diffDirAbsPath); err != nil {
+			return err
+		}
+	}
+	log.Println(i18n.T("补丁描述文件生成成功"))
+
+	if err := patch.WriteManifest(diffDirAbsPath, patchManifest); err != nil {
+		return fmt.Errorf(i18n.T("输出补丁描述文件错误：%w"), err)
+	}
+	return nil
+}
+
+// adaptiveFileBulkSize 按旧文件和新文件的大小返回 AdaptiveBulkSize
+func adaptiveFileBulkSize(maxBulkSize int, oldFilePath, newFilePath string) (int, error) {
+	oldFileSize, err := util.GetFileSize(oldFilePath)
+	if err != nil {
+		return 0, err
+	}
+	newFileSize, err := util.GetFileSize(newFilePath)
+	if err != nil {
+		return 0, err
+	}
+	return AdaptiveBulkSize(maxBulkSize, oldFileSize, newFileSize), nil
+}
@@ -0,0 +1,113 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ganlvtech/go-dir-bsdiff/internal/testutil"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// generate 与 diff 子命令相同，扫描两个文件夹后生成补丁
+func generate(t *testing.T, options *Options, oldDirAbsPath, newDirAbsPath, diffDirAbsPath string, bulkSize int) *patch.Manifest {
+	t.Helper()
+	scans := testutil.ScanDirs(t, oldDirAbsPath, newDirAbsPath)
+	if err := Generate(context.Background(), options, oldDirAbsPath, newDirAbsPath, diffDirAbsPath, scans[0], scans[1], bulkSize, patch.SymlinkPolicyAllow, nil); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := patch.ReadManifest(diffDirAbsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func newOptions(t *testing.T) *Options {
+	t.Helper()
+	options, err := NewOptions("bsdiff", "zstd", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return options
+}
+
+func TestGenerateOldMd5OnlyForOperationsUsingOldFile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := testutil.RandomBytes(rng, 100000)
+	edited := append([]byte(nil), base...)
+	copy(edited[5000:], "edited")
+
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	diffDir := filepath.Join(root, "diff")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{
+		"patched.bin":  base,
+		"replaced.bin": testutil.RandomBytes(rng, 1000),
+		"zeroed.bin":   testutil.RandomBytes(rng, 1000),
+		"same.bin":     []byte("same"),
+	})
+	testutil.WriteFiles(t, newDir, map[string][]byte{
+		"patched.bin":  edited,
+		"replaced.bin": testutil.RandomBytes(rng, 1000),
+		"zeroed.bin":   make([]byte, 4096),
+		"same.bin":     []byte("same"),
+	})
+
+	manifest := generate(t, newOptions(t), oldDir, newDir, diffDir, 1<<20)
+	for name, want := range map[string]bool{"patched.bin": true, "replaced.bin": false, "zeroed.bin": false, "same.bin": true} {
+		if _, ok := manifest.OldMd5[name]; ok != want {
+			t.Errorf("%s（%s）是否有 old_md5：%v，期望 %v", name, manifest.Patches[name], ok, want)
+		}
+	}
+
+	// 不需要旧文件的操作不检查旧文件，旧文件被修改时也能应用
+	testutil.WriteFiles(t, oldDir, map[string][]byte{
+		"replaced.bin": []byte("modified"),
+		"zeroed.bin":   []byte("modified"),
+	})
+	patchedDir := filepath.Join(root, "patched")
+	if err := patch.Apply(context.Background(), oldDir, patchedDir, diffDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertSameDir(t, newDir, patchedDir)
+
+	got, err := os.ReadFile(filepath.Join(patchedDir, "zeroed.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, make([]byte, 4096)) {
+		t.Errorf("zeroed.bin 内容不正确")
+	}
+}
+
+// 重新生成到同一个差异文件夹时，新增文件的差异文件按新的内容重新写入
+func TestGenerateRewritesExistingPayload(t *testing.T) {
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	diffDir := filepath.Join(root, "diff")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"same.bin": []byte("same")})
+	testutil.WriteFiles(t, newDir, map[string][]byte{"same.bin": []byte("same"), "added.bin": []byte("first")})
+	generate(t, newOptions(t), oldDir, newDir, diffDir, 1<<20)
+
+	for name, content := range map[string][]byte{"内容改变": []byte("second"), "全部为 0": make([]byte, 4096)} {
+		t.Run(name, func(t *testing.T) {
+			testutil.WriteFiles(t, newDir, map[string][]byte{"added.bin": content})
+			generate(t, newOptions(t), oldDir, newDir, diffDir, 1<<20)
+			patchedDir := filepath.Join(t.TempDir(), "patched")
+			if err := patch.Apply(context.Background(), oldDir, patchedDir, diffDir, nil); err != nil {
+				t.Fatal(err)
+			}
+			testutil.AssertSameDir(t, newDir, patchedDir)
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+// squashStep 是文件在一个补丁中发生的修改，Index 是补丁的序号
+type squashStep struct {
+	Index      int
+	Operations []patch.PartOperation
+}
+
+type squasher struct {
+	ctx             context.Context
+	options         *Options
+	oldDirAbsPath   string
+	outDirAbsPath   string
+	tempDirAbsPath  string
+	diffDirAbsPaths []string
+	manifests       []*patch.Manifest
+	lastTreeMd5     map[string]string
+	result          *patch.Manifest
+}
+
+// Squash 把依次应用的多个补丁合并为一个从旧版文件夹直接更新到最后一个版本的补丁，写入 outDirAbsPath
+//
+// 只在一个补丁中修改过的文件或文件块直接复制原来的差异文件，修改过多次的才用旧版文件夹中的文件和
+// 依次应用补丁得到的新文件重新计算差异。不需要中间版本的文件夹，只在临时文件夹中逐个生成需要重新计算的文件。
+// ctx 取消后删除临时文件夹并返回 ctx 的错误。
+func Squash(ctx context.Context, options *Options, oldDirAbsPath, outDirAbsPath string, diffDirAbsPaths []string) (*patch.Manifest, error) {
+	if len(diffDirAbsPaths) == 0 {
+		return nil, errors.New(i18n.T("没有指定补丁"))
+	}
+	manifests := make([]*patch.Manifest, len(diffDirAbsPaths))
+	for i, diffDirAbsPath := range diffDirAbsPaths {
+		manifest, err := patch.ReadManifest(diffDirAbsPath)
+		if err != nil {
+			return nil, fmt.Errorf(i18n.T("读取第 %d 个补丁描述文件错误：%w"), i+1, err)
+		}
+		manifests[i] = manifest
+	}
+	if err := patch.CheckChain(manifests); err != nil {
+		return nil, err
+	}
+	tempDirAbsPath, err := ioutil.TempDir(outDirAbsPath, ".bsdiff-squash-")
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("创建临时文件夹错误：%w"), err)
+	}
+	defer os.RemoveAll(tempDirAbsPath)
+
+	last := manifests[len(manifests)-1]
+	result := patch.NewPatchManifest(last.BulkSize)
+	result.OldMd5 = make(map[string]string)
+	result.NewMd5 = make(map[string]string)
+	result.Patches = make(map[string]string)
+	result.Symlinks = last.Symlinks
+	result.Dirs = last.Dirs
+	result.RemovedDirs = squashRemovedDirs(manifests)
+	result.OldHash = manifests[0].OldHash
+	result.NewHash = last.NewHash
+	result.NewSize = make(map[string]int64, len(last.Patches))
+	result.BulkSizes = make(map[string]int)
+	s := &squasher{
+		ctx:             ctx,
+		options:         options,
+		oldDirAbsPath:   oldDirAbsPath,
+		outDirAbsPath:   outDirAbsPath,
+		tempDirAbsPath:  tempDirAbsPath,
+		diffDirAbsPaths: diffDirAbsPaths,
+		manifests:       manifests,
+		lastTreeMd5:     last.NewTreeMd5(),
+		result:          result,
+	}
+	fileNames := make([]string, 0, len(last.Patches))
+	for fileName := range last.Patches {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.squashFile(fileName); err != nil {
+			return nil, fmt.Errorf(i18n.T("%s 合并错误：%w"), fileName, err)
+		}
+	}
+	return result, nil
+}
+
+// squashRemovedDirs 返回任意一个补丁中删除、且最后一个版本中不存在的文件夹
+func squashRemovedDirs(manifests []*patch.Manifest) []string {
+	lastDirs := make(map[string]bool)
+	for _, dirName := range manifests[len(manifests)-1].Dirs {
+		lastDirs[dirName] = true
+	}
+	removedDirs := make(map[string]bool)
+	for _, manifest := range manifests {
+		for _, dirName := range manifest.RemovedDirs {
+			if !lastDirs[dirName] {
+				removedDirs[dirName] = true
+			}
+		}
+	}
+	result := make([]string, 0, len(removedDirs))
+	for dirName := range removedDirs {
+		result = append(result, dirName)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (s *squasher) squashFile(fileName string) error {
+	// 从最后一个补丁向前查找文件的修改，直到第一个补丁或者不需要旧文件的修改
+	changes := make([]squashStep, 0)
+	inOldDir := true
+	for k := len(s.manifests) - 1; k >= 0; k-- {
+		operation, ok := s.manifests[k].Patches[fileName]
+		if !ok {
+			return fmt.Errorf(i18n.T("第 %d 个补丁中没有这个文件"), k+1)
+		}
+		if operation == patch.OperationTypeCopyOld {
+			continue
+		}
+		partOperations := patch.ParseOperation(operation)
+		changes = append(changes, squashStep{Index: k, Operations: partOperations})
+		if !patch.UsesOldFile(partOperations) {
+			inOldDir = false
+			break
+		}
+	}
+	if len(changes) > 0 {
+		if newFileSize, ok := s.manifests[changes[0].Index].NewSize[fileName]; ok {
+			s.result.NewSize[fileName] = newFileSize
+		}
+	} else {
+		newFileSize, err := util.GetFileSize(filepath.Join(s.oldDirAbsPath, fileName))
+		if err != nil {
+			return err
+		}
+		s.result.NewSize[fileName] = newFileSize
+	}
+	oldFileMD5 := ""
+	if inOldDir {
+		oldFileMD5 = s.manifests[0].OldMd5[fileName]
+		if oldFileMD5 == "" {
+			return errors.New(i18n.T("第 1 个补丁中没有旧版文件的 md5"))
+		}
+	}
+	if len(changes) == 0 {
+		log.Println(fileName, i18n.T("未修改"))
+		s.result.Patches[fileName] = patch.OperationTypeCopyOld
+		s.result.OldMd5[fileName] = oldFileMD5
+		return nil
+	}
+	if bulkSize := s.manifests[len(s.manifests)-1].FileBulkSize(fileName); bulkSize != s.result.BulkSize {
+		s.result.BulkSizes[fileName] = bulkSize
+	}
+	if len(changes) == 1 && s.canReuse(fileName, changes[0]) {
+		log.Printf(i18n.T("%s 只在第 %d 个补丁中修改，复制差异文件"), fileName, changes[0].Index+1)
+		if err := s.reuseFile(fileName, changes[0]); err != nil {
+			return err
+		}
+		s.setResult(fileName, joinOperations(changes[0].Operations), oldFileMD5)
+		return nil
+	}
+	if len(changes) > 1 && inOldDir && s.canSquashParts(fileName, changes) {
+		ok, err := s.squashParts(fileName, changes, oldFileMD5)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		log.Println(fileName, i18n.T("逐块合并的结果不正确，重新计算整个文件"))
+	}
+	return s.recompute(fileName, changes, inOldDir, oldFileMD5)
+}
+
+func joinOperations(partOperations []patch.PartOperation) string {
+	results := make([]string, len(partOperations))
+	for i, partOperation := range partOperations {
+		results[i] = partOperation.String()
+	}
+	return strings.Join(results, patch.PartOperationSeparator)
+}
+
+func (s *squasher) setResult(fileName, operation, oldFileMD5 string) {
+	s.result.Patches[fileName] = operation
+	s.result.NewMd5[fileName] = s.lastTreeMd5[fileName]
+	if oldFileMD5 != "" && patch.UsesOldFile(patch.ParseOperation(operation)) {
+		s.result.OldMd5[fileName] = oldFileMD5
+	}
+}
+
+// canReuse 判断一次修改的差异文件能否直接复制，分块大小不同的分块文件不能复制
+func (s *squasher) canReuse(fileName string, change squashStep) bool {
+	return len(change.Operations) == 1 || s.manifests[change.Index].FileBulkSize(fileName) == s.result.FileBulkSize(fileName)
+}
+
+// canSquashParts 判断能否逐块合并：每次修改都必须是分块的且分块大小相同
+func (s *squasher) canSquashParts(fileName string, changes []squashStep) bool {
+	for _, change := range changes {
+		if len(change.Operations) == 1 || s.manifests[change.Index].FileBulkSize(fileName) != s.result.FileBulkSize(fileName) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *squasher) mkdirFor(filePath string) error {
+	dirPath := filepath.Dir(filePath)
+	if mkdirResult, err := util.MkdirIfNotExists(dirPath); err != nil {
+		return fmt.Errorf(i18n.T("%s 创建文件夹失败：%w"), dirPath, err)
+	} else if mkdirResult == util.MkdirIfNotExistsResultExistsFile {
+		return fmt.Errorf(i18n.T("%s 路径存在，但不是文件夹"), dirPath)
+	}
+	return nil
+}
+
+// copyPayload 复制一次修改中第 partIndex 块的差异文件，partIndex 为 0 表示未分块的文件
+func (s *squasher) copyPayload(fileName string, change squashStep, partIndex int) error {
+	operation := change.Operations[0]
+	if partIndex > 0 {
+		operation = change.Operations[partIndex-1]
+	}
+	srcPath := s.manifests[change.Index].PayloadFileName(s.diffDirAbsPaths[change.Index], fileName, partIndex, operation)
+	if srcPath == "" {
+		return nil
+	}
+	dstPath := patch.GetPayloadFileName(filepath.Join(s.outDirAbsPath, fileName), partIndex, operation)
+	if err := s.mkdirFor(dstPath); err != nil {
+		return err
+	}
+	if err := util.CopyFileContext(s.ctx, dstPath, srcPath); err != nil {
+		return fmt.Errorf(i18n.T("复制差异文件 %s 错误：%w"), srcPath, err)
+	}
+	return nil
+}
+
+// reuseFile 复制一次修改的全部差异文件
+func (s *squasher) reuseFile(fileName string, change squashStep) error {
+	if len(change.Operations) == 1 {
+		return s.copyPayload(fileName, change, 0)
+	}
+	for i := range change.Operations {
+		if err := s.copyPayload(fileName, change, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuild 从旧版文件夹开始依次应用各次修改，在临时文件夹中生成最后一个版本的文件，返回文件路径
+func (s *squasher) rebuild(fileName string, changes []squashStep) (string, error) {
+	srcDirAbsPath := s.oldDirAbsPath
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		dstDirAbsPath := filepath.Join(s.tempDirAbsPath, fmt.Sprintf("%d", i%2))
+		manifest := s.manifests[change.Index]
+		err := patch.ApplyFile(s.ctx, manifest, srcDirAbsPath, dstDirAbsPath, patch.DirSource(s.diffDirAbsPaths[change.Index]), fileName, manifest.Patches[fileName], patch.CopyModeCopy)
+		if err != nil {
+			return "", err
+		}
+		if srcDirAbsPath != s.oldDirAbsPath {
+			if err := os.Remove(filepath.Join(srcDirAbsPath, fileName)); err != nil {
+				return "", err
+			}
+		}
+		srcDirAbsPath = dstDirAbsPath
+	}
+	return filepath.Join(srcDirAbsPath, fileName), nil
+}
+
+// recompute 重新生成最后一个版本的文件，旧版文件夹中有这个文件时与旧文件计算差异，否则作为新增文件复制
+func (s *squasher) recompute(fileName string, changes []squashStep, inOldDir bool, oldFileMD5 string) error {
+	log.Printf(i18n.T("%s 修改了 %d 次，重新计算差异"), fileName, len(changes))
+	newFilePath, err := s.rebuild(fileName, changes)
+	if err != nil {
+		return fmt.Errorf(i18n.T("生成新文件错误：%w"), err)
+	}
+	defer os.Remove(newFilePath)
+	diffFileBasePath := filepath.Join(s.outDirAbsPath, fileName)
+	if err := s.mkdirFor(diffFileBasePath); err != nil {
+		return err
+	}
+	var result string
+	if inOldDir {
+		oldFilePath := filepath.Join(s.oldDirAbsPath, fileName)
+		usePatchFrom, err := UsePatchFrom(s.options, oldFilePath, newFilePath)
+		if err != nil {
+			return err
+		}
+		if usePatchFrom {
+			result, err = DoPatchFrom(s.ctx, s.options, oldFilePath, newFilePath, diffFileBasePath)
+		} else {
+			result, _, err = DoBsDiff(s.ctx, s.options, oldFilePath, newFilePath, diffFileBasePath, s.result.FileBulkSize(fileName))
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		result, err = CopyNewFile(s.ctx, s.options, diffFileBasePath, newFilePath)
+		if err != nil {
+			return err
+		}
+	}
+	s.setResult(fileName, result, oldFileMD5)
+	return nil
+}
+
+// squashParts 逐块合并：只在一次修改中变化的块复制原来的差异文件，变化多次的块重新计算差异
+//
+// 合并后用旧文件应用一遍检查结果，不正确时删除已生成的文件并返回 false
+func (s *squasher) squashParts(fileName string, changes []squashStep, oldFileMD5 string) (bool, error) {
+	partCount := len(changes[0].Operations)
+	results := make([]patch.PartOperation, partCount)
+	sources := make([]*squashStep, partCount)
+	for i := 0; i < partCount; i++ {
+		results[i] = patch.PartOperation{Type: patch.OperationTypeCopyOld}
+		count := 0
+		for k := range changes {
+			if i >= len(changes[k].Operations) {
+				return false, nil
+			}
+			partOperation := changes[k].Operations[i]
+			if partOperation.Type == patch.OperationTypeCopyOld {
+				continue
+			}
+			count++
+			if count == 1 {
+				results[i] = partOperation
+				sources[i] = &changes[k]
+			}
+			if partOperation.Type == patch.OperationTypeCopyNew || partOperation.Type == patch.OperationTypeZero {
+				break
+			}
+		}
+		if count > 1 {
+			sources[i] = nil
+			results[i] = patch.PartOperation{}
+		}
+	}
+
+	diffFileBasePath := filepath.Join(s.outDirAbsPath, fileName)
+	if err := s.mkdirFor(diffFileBasePath); err != nil {
+		return false, err
+	}
+	oldFilePath := filepath.Join(s.oldDirAbsPath, fileName)
+	newFilePath := ""
+	recomputed := 0
+	for i := 0; i < partCount; i++ {
+		if results[i].Type == patch.OperationTypeCopyOld {
+			continue
+		}
+		if sources[i] != nil {
+			if err := s.copyPayload(fileName, *sources[i], i+1); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if newFilePath == "" {
+			var err error
+			newFilePath, err = s.rebuild(fileName, changes)
+			if err != nil {
+				return false, fmt.Errorf(i18n.T("生成新文件错误：%w"), err)
+			}
+			defer os.Remove(newFilePath)
+		}
+		oldBytes, err := readFilePart(oldFilePath, i, s.result.FileBulkSize(fileName), false)
+		if err != nil {
+			return false, fmt.Errorf(i18n.T("读取旧版文件错误：%w"), err)
+		}
+		newBytes, err := readFilePart(newFilePath, i, s.result.FileBulkSize(fileName), i == partCount-1)
+		if err != nil {
+			return false, fmt.Errorf(i18n.T("读取新版文件错误：%w"), err)
+		}
+		result, _, err := DoBsDiffPart(s.ctx, s.options, oldBytes, newBytes, patch.GetPartNewFileName(diffFileBasePath, i+1))
+		if err != nil {
+			return false, fmt.Errorf(i18n.T("第 %d 块文件计算差异错误：%w"), i+1, err)
+		}
+		results[i] = patch.ParsePartOperation(result)
+		recomputed++
+	}
+
+	// 检查合并结果
+	checkFilePath := filepath.Join(s.tempDirAbsPath, "check")
+	defer os.Remove(checkFilePath)
+	err := patch.AutoPartPatch(s.ctx, s.result, checkFilePath, oldFilePath, patch.DirSource(s.outDirAbsPath), fileName, results)
+	if err != nil {
+		return false, fmt.Errorf(i18n.T("检查合并结果错误：%w"), err)
+	}
+	checkFileMD5, err := util.FileMD5(checkFilePath)
+	if err != nil {
+		return false, fmt.Errorf(i18n.T("检查合并结果错误：%w"), err)
+	}
+	if checkFileMD5 != s.lastTreeMd5[fileName] {
+		for i, partOperation := range results {
+			if payloadPath := patch.GetPayloadFileName(diffFileBasePath, i+1, partOperation); payloadPath != "" {
+				os.Remove(payloadPath)
+			}
+		}
+		return false, nil
+	}
+	log.Printf(i18n.T("%s 逐块合并完成，重新计算了 %d 块"), fileName, recomputed)
+	s.setResult(fileName, joinOperations(results), oldFileMD5)
+	return true, nil
+}
+
+// readFilePart 读取文件的第 partIndex 块（从 0 开始），toEnd 为 true 时读取到文件末尾
+func readFilePart(filePath string, partIndex int, bulkSize int, toEnd bool) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(int64(partIndex)*int64(bulkSize), io.SeekStart); err != nil {
+		return nil, err
+	}
+	if toEnd {
+		return ioutil.ReadAll(f)
+	}
+	return patch.ReadPart(f, bulkSize)
+}
@@ -0,0 +1,237 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ganlvtech/go-dir-bsdiff/internal/testutil"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+const squashTestBulkSize = 64 << 10
+
+// squashTestChain 生成 4 个版本的文件夹和依次更新的 3 个补丁，返回旧版文件夹、最新版文件夹和补丁文件夹
+//
+//   - same.bin 没有修改
+//   - once.bin 只在第 2 个补丁中修改
+//   - twice.bin 未分块，在第 1、3 个补丁中修改
+//   - added.bin 在第 2 个补丁中新增，第 3 个补丁中修改
+//   - removed.bin 在第 2 个补丁中删除
+//   - chunked.bin 分为 4 块，第 1 个补丁修改第 1、2 块，第 2 个补丁修改第 3 块，第 3 个补丁再次修改第 2 块
+//   - zeroed.bin 分为 3 块，第 2 个补丁把第 2 块改为全 0，第 3 个补丁修改第 1 块
+func squashTestChain(t *testing.T) (string, string, []string) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	edit := func(b []byte, offset int) []byte {
+		b = append([]byte(nil), b...)
+		copy(b[offset:], testutil.RandomBytes(rng, 100))
+		return b
+	}
+	v1 := map[string][]byte{
+		"same.bin":    testutil.RandomBytes(rng, 1000),
+		"once.bin":    testutil.RandomBytes(rng, 20000),
+		"twice.bin":   testutil.RandomBytes(rng, 30000),
+		"removed.bin": testutil.RandomBytes(rng, 1000),
+		"chunked.bin": testutil.RandomBytes(rng, 4*squashTestBulkSize),
+		"zeroed.bin":  testutil.RandomBytes(rng, 3*squashTestBulkSize),
+	}
+	v2 := map[string][]byte{
+		"same.bin":    v1["same.bin"],
+		"once.bin":    v1["once.bin"],
+		"twice.bin":   edit(v1["twice.bin"], 1000),
+		"removed.bin": v1["removed.bin"],
+		"chunked.bin": edit(edit(v1["chunked.bin"], 1000), squashTestBulkSize+1000),
+		"zeroed.bin":  v1["zeroed.bin"],
+	}
+	zeroed := append([]byte(nil), v2["zeroed.bin"]...)
+	copy(zeroed[squashTestBulkSize:], make([]byte, squashTestBulkSize))
+	v3 := map[string][]byte{
+		"same.bin":    v2["same.bin"],
+		"once.bin":    edit(v2["once.bin"], 5000),
+		"twice.bin":   v2["twice.bin"],
+		"added.bin":   testutil.RandomBytes(rng, 5000),
+		"chunked.bin": edit(v2["chunked.bin"], 2*squashTestBulkSize+1000),
+		"zeroed.bin":  zeroed,
+	}
+	v4 := map[string][]byte{
+		"same.bin":    v3["same.bin"],
+		"once.bin":    v3["once.bin"],
+		"twice.bin":   edit(v3["twice.bin"], 20000),
+		"added.bin":   edit(v3["added.bin"], 100),
+		"chunked.bin": edit(v3["chunked.bin"], squashTestBulkSize+5000),
+		"zeroed.bin":  edit(v3["zeroed.bin"], 1000),
+	}
+
+	root := t.TempDir()
+	versions := []map[string][]byte{v1, v2, v3, v4}
+	dirs := make([]string, len(versions))
+	for i, files := range versions {
+		dirs[i] = filepath.Join(root, "v"+string(rune('1'+i)))
+		testutil.WriteFiles(t, dirs[i], files)
+	}
+	options := newOptions(t)
+	diffDirs := make([]string, len(versions)-1)
+	for i := range diffDirs {
+		diffDirs[i] = filepath.Join(root, "d"+string(rune('1'+i))+string(rune('2'+i)))
+		generate(t, options, dirs[i], dirs[i+1], diffDirs[i], squashTestBulkSize)
+	}
+	return dirs[0], dirs[len(dirs)-1], diffDirs
+}
+
+func readPayload(t *testing.T, manifest *patch.Manifest, diffDirAbsPath, fileName string, partIndex int) []byte {
+	t.Helper()
+	partOperations := patch.ParseOperation(manifest.Patches[fileName])
+	operation := partOperations[0]
+	if partIndex > 0 {
+		operation = partOperations[partIndex-1]
+	}
+	b, err := os.ReadFile(manifest.PayloadFileName(diffDirAbsPath, fileName, partIndex, operation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSquashMatchesChain(t *testing.T) {
+	oldDir, newDir, diffDirs := squashTestChain(t)
+	ctx := context.Background()
+	root := filepath.Dir(oldDir)
+
+	outDir := filepath.Join(root, "squashed")
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := Squash(ctx, newOptions(t), oldDir, outDir, diffDirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := patch.WriteManifest(outDir, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	// 合并后的补丁与依次应用多个补丁的结果相同
+	squashedDir := filepath.Join(root, "squashed-new")
+	if err := patch.Apply(ctx, oldDir, squashedDir, outDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	chainDir := filepath.Join(root, "chain-new")
+	if err := patch.ApplyChain(ctx, oldDir, chainDir, diffDirs, nil); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertSameDir(t, newDir, squashedDir)
+	testutil.AssertSameDir(t, newDir, chainDir)
+
+	manifests := make([]*patch.Manifest, len(diffDirs))
+	for i, diffDir := range diffDirs {
+		if manifests[i], err = patch.ReadManifest(diffDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if manifest.Patches["same.bin"] != patch.OperationTypeCopyOld {
+		t.Errorf("same.bin 的操作为 %s", manifest.Patches["same.bin"])
+	}
+	if _, ok := manifest.Patches["removed.bin"]; ok {
+		t.Errorf("removed.bin 不应该在合并后的补丁中")
+	}
+
+	// 只修改过一次的文件复制原来的差异文件
+	if manifest.Patches["once.bin"] != manifests[1].Patches["once.bin"] {
+		t.Errorf("once.bin 的操作为 %s，期望 %s", manifest.Patches["once.bin"], manifests[1].Patches["once.bin"])
+	} else if !bytes.Equal(readPayload(t, manifest, outDir, "once.bin", 0), readPayload(t, manifests[1], diffDirs[1], "once.bin", 0)) {
+		t.Errorf("once.bin 的差异文件与第 2 个补丁中的不同")
+	}
+
+	// 修改过多次的文件重新计算差异，不在旧版文件夹中的作为新增文件
+	if op := patch.ParseOperation(manifest.Patches["twice.bin"]); len(op) != 1 || op[0].Type != patch.OperationTypePatch {
+		t.Errorf("twice.bin 的操作为 %s", manifest.Patches["twice.bin"])
+	}
+	if op := patch.ParseOperation(manifest.Patches["added.bin"]); len(op) != 1 || op[0].Type != patch.OperationTypeCopyNew {
+		t.Errorf("added.bin 的操作为 %s", manifest.Patches["added.bin"])
+	}
+	if _, ok := manifest.OldMd5["added.bin"]; ok {
+		t.Errorf("added.bin 不应该有 old_md5")
+	}
+
+	// 分块文件逐块合并：只修改过一次的块复制差异文件，修改过多次的块重新计算
+	chunked := patch.ParseOperation(manifest.Patches["chunked.bin"])
+	if len(chunked) != 4 || chunked[0].Type != patch.OperationTypePatch || chunked[1].Type != patch.OperationTypePatch || chunked[2].Type != patch.OperationTypePatch || chunked[3].Type != patch.OperationTypeCopyOld {
+		t.Fatalf("chunked.bin 的操作为 %s", manifest.Patches["chunked.bin"])
+	}
+	if !bytes.Equal(readPayload(t, manifest, outDir, "chunked.bin", 1), readPayload(t, manifests[0], diffDirs[0], "chunked.bin", 1)) {
+		t.Errorf("chunked.bin 第 1 块的差异文件与第 1 个补丁中的不同")
+	}
+	if !bytes.Equal(readPayload(t, manifest, outDir, "chunked.bin", 3), readPayload(t, manifests[1], diffDirs[1], "chunked.bin", 3)) {
+		t.Errorf("chunked.bin 第 3 块的差异文件与第 2 个补丁中的不同")
+	}
+	zeroed := patch.ParseOperation(manifest.Patches["zeroed.bin"])
+	if len(zeroed) != 3 || zeroed[0].Type != patch.OperationTypePatch || zeroed[1].Type != patch.OperationTypeZero || zeroed[2].Type != patch.OperationTypeCopyOld {
+		t.Errorf("zeroed.bin 的操作为 %s", manifest.Patches["zeroed.bin"])
+	}
+}
+
+// 逐块合并的结果不正确时返回 false 并删除已生成的差异文件，由调用方改为重新计算整个文件
+func TestSquashPartsVerifyFallback(t *testing.T) {
+	oldDir, _, diffDirs := squashTestChain(t)
+	manifests := make([]*patch.Manifest, len(diffDirs))
+	for i, diffDir := range diffDirs {
+		var err error
+		if manifests[i], err = patch.ReadManifest(diffDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outDir := t.TempDir()
+	result := patch.NewPatchManifest(squashTestBulkSize)
+	result.OldMd5 = make(map[string]string)
+	result.NewMd5 = make(map[string]string)
+	result.Patches = make(map[string]string)
+	s := &squasher{
+		ctx:             context.Background(),
+		options:         newOptions(t),
+		oldDirAbsPath:   oldDir,
+		outDirAbsPath:   outDir,
+		tempDirAbsPath:  t.TempDir(),
+		diffDirAbsPaths: diffDirs,
+		manifests:       manifests,
+		lastTreeMd5:     manifests[2].NewTreeMd5(),
+		result:          result,
+	}
+
+	// 缺少第 2 个补丁中对第 3 块的修改，合并结果与最后一个版本不一致
+	const fileName = "chunked.bin"
+	changes := []squashStep{
+		{Index: 2, Operations: patch.ParseOperation(manifests[2].Patches[fileName])},
+		{Index: 0, Operations: patch.ParseOperation(manifests[0].Patches[fileName])},
+	}
+	ok, err := s.squashParts(fileName, changes, manifests[0].OldMd5[fileName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("合并结果不正确时应该返回 false")
+	}
+	if _, exists := result.Patches[fileName]; exists {
+		t.Errorf("合并结果不正确时不应该写入补丁描述文件")
+	}
+	matches, err := filepath.Glob(filepath.Join(outDir, fileName+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("合并结果不正确时应该删除已生成的差异文件：%v", matches)
+	}
+
+	// 完整的修改可以逐块合并
+	changes = []squashStep{
+		{Index: 2, Operations: patch.ParseOperation(manifests[2].Patches[fileName])},
+		{Index: 1, Operations: patch.ParseOperation(manifests[1].Patches[fileName])},
+		{Index: 0, Operations: patch.ParseOperation(manifests[0].Patches[fileName])},
+	}
+	if ok, err := s.squashParts(fileName, changes, manifests[0].OldMd5[fileName]); err != nil || !ok {
+		t.Fatalf("squashParts = %v, %v", ok, err)
+	}
+}
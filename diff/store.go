@@ -0,0 +1,128 @@
+package diff
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+// PayloadStoreDirName 是多个补丁共用的差异文件存储在差异文件夹中的文件夹名称
+const PayloadStoreDirName = "payloads"
+
+// PayloadStore 是多个补丁共用的差异文件存储，文件名为文件内容的 MD5 加上原来的后缀名，相同内容的差异文件只保存一份
+type PayloadStore struct {
+	DirAbsPath string
+	// newFiles 是新增文件的 MD5 和压缩算法到存储中文件名的映射，多个补丁中相同的新增文件只需要复制一次
+	newFiles map[string]string
+}
+
+func NewPayloadStore(dirAbsPath string) (*PayloadStore, error) {
+	if mkdirResult, err := util.MkdirIfNotExists(dirAbsPath); err != nil {
+		return nil, err
+	} else if mkdirResult == util.MkdirIfNotExistsResultExistsFile {
+		return nil, fmt.Errorf(i18n.T("%s 路径存在，但不是文件夹"), dirAbsPath)
+	}
+	return &PayloadStore{DirAbsPath: dirAbsPath, newFiles: make(map[string]string)}, nil
+}
+
+func newFileKey(newFileMD5, compression string) string {
+	return newFileMD5 + patch.OperationArgumentSeparator + compression
+}
+
+// NewFileObject 返回已经保存过的新增文件在存储中的文件名
+func (s *PayloadStore) NewFileObject(newFileMD5, compression string) (string, bool) {
+	object, ok := s.newFiles[newFileKey(newFileMD5, compression)]
+	return object, ok
+}
+
+// add 把差异文件移动到存储中，存储中已有相同内容的文件时直接删除
+func (s *PayloadStore) add(payloadPath string, suffix string) (string, error) {
+	payloadMD5, err := util.FileMD5(payloadPath)
+	if err != nil {
+		return "", err
+	}
+	object := payloadMD5 + suffix
+	objectPath := filepath.Join(s.DirAbsPath, object)
+	if fileInfoResult, err := util.GetFileInfo(objectPath); err != nil {
+		return "", err
+	} else if fileInfoResult == util.FileInfoResultExistFile {
+		return object, os.Remove(payloadPath)
+	}
+	return object, os.Rename(payloadPath, objectPath)
+}
+
+// Collect 把补丁的全部差异文件移动到存储中，在补丁描述文件中记录存储的路径和每个差异文件在存储中的文件名，
+// 最后删除差异文件夹中的空文件夹
+func (s *PayloadStore) Collect(manifest *patch.Manifest, diffDirAbsPath string) error {
+	storeRelPath, err := filepath.Rel(diffDirAbsPath, s.DirAbsPath)
+	if err != nil {
+		return err
+	}
+	manifest.PayloadStore = filepath.ToSlash(storeRelPath)
+	if manifest.Payloads == nil {
+		manifest.Payloads = make(map[string]string)
+	}
+	for fileName, operation := range manifest.Patches {
+		partOperations := patch.ParseOperation(operation)
+		for i, partOperation := range partOperations {
+			partIndex := i + 1
+			if len(partOperations) == 1 {
+				partIndex = 0
+			}
+			key := patch.GetPayloadKey(fileName, partIndex, partOperation)
+			if key == "" {
+				continue
+			}
+			if _, ok := manifest.Payloads[key]; ok {
+				continue
+			}
+			payloadPath := patch.GetPayloadFileName(filepath.Join(diffDirAbsPath, fileName), partIndex, partOperation)
+			suffix := patch.GetPayloadFileName("", 0, partOperation)
+			object, err := s.add(payloadPath, suffix)
+			if err != nil {
+				return fmt.Errorf(i18n.T("%s 移动差异文件到存储错误：%w"), fileName, err)
+			}
+			manifest.Payloads[key] = object
+			if partIndex == 0 && partOperation.Type == patch.OperationTypeCopyNew {
+				s.newFiles[newFileKey(manifest.NewMd5[fileName], partOperation.Argument)] = object
+			}
+		}
+	}
+	return removeEmptyDirs(diffDirAbsPath)
+}
+
+// removeEmptyDirs 删除文件夹中的全部空文件夹，不删除 dirAbsPath 本身
+func removeEmptyDirs(dirAbsPath string) error {
+	dirPaths := make([]string, 0)
+	err := filepath.Walk(dirAbsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != dirAbsPath {
+			dirPaths = append(dirPaths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirPaths)))
+	for _, dirPath := range dirPaths {
+		entries, err := ioutil.ReadDir(dirPath)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			if err := os.Remove(dirPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
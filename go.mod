@@ -1,5 +1,9 @@
 module github.com/ganlvtech/go-dir-bsdiff
 
-go 1.14
+go 1.22
 
-require github.com/gabstv/go-bsdiff v1.0.5
+require (
+	github.com/dsnet/compress v0.0.0-20171208185109-cc9eb1d7ad76
+	github.com/gabstv/go-bsdiff v1.0.5
+	github.com/klauspost/compress v1.18.0
+)
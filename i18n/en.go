@@ -0,0 +1,316 @@
+package i18n
+
+// english 是英文翻译，键是源代码中的中文文字
+var english = map[string]string{
+	// i18n
+	"不支持的语言 %s，可用的语言：zh、en": "unsupported language %s, available languages: zh, en",
+
+	// cmd/dirbsdiff
+	"使用方法：\n\n" +
+		"    dirbsdiff [-lang zh|en] [-timeout 时长] <子命令> [选项]\n\n" +
+		"界面语言默认按 LC_ALL、LC_MESSAGES、LANG 环境变量选择，也可以用 -lang 指定\n" +
+		"-timeout 指定最长运行时间，如 30m，超时或收到中断信号时停止并删除未完成的文件\n\n" +
+		"子命令：\n\n" +
+		"    diff    计算旧版和新版文件夹的差异，生成补丁\n" +
+		"    patch   应用补丁，把旧版文件夹更新到新版文件夹\n" +
+		"    verify  检查文件夹能否应用补丁，或者是否与补丁生成的结果一致\n" +
+		"    info    查看补丁中每个文件的操作和差异文件大小\n" +
+		"    chain   依次应用多个补丁\n" +
+		"    squash  把依次应用的多个补丁合并为一个补丁\n" +
+		"    serve   通过 HTTP 提供补丁，查询从某个版本更新到最新版本需要的补丁\n" +
+		"    hash    计算文件夹的版本哈希\n\n" +
+		"使用 dirbsdiff <子命令> -h 查看子命令的选项\n\n" +
+		"使用到的开源软件：\n\n" +
+		"    Pure Go bsdiff and bspatch libraries and CLI tools.\n" +
+		"        https://github.com/gabstv/go-bsdiff\n\n" +
+		"本程序使用 Go 语言开发，由 %s 生成\n": "Usage:\n\n" +
+		"    dirbsdiff [-lang zh|en] [-timeout duration] <command> [options]\n\n" +
+		"The interface language is chosen from the LC_ALL, LC_MESSAGES and LANG environment variables, or with -lang\n" +
+		"-timeout limits the running time, e.g. 30m; on timeout or interrupt the command stops and removes unfinished files\n\n" +
+		"Commands:\n\n" +
+		"    diff    compare an old and a new folder and generate a patch\n" +
+		"    patch   apply a patch to update an old folder to the new folder\n" +
+		"    verify  check whether a folder can take a patch, or matches the patch result\n" +
+		"    info    show the operation and payload size of every file in a patch\n" +
+		"    chain   apply several patches in sequence\n" +
+		"    squash  merge several sequential patches into one patch\n" +
+		"    serve   serve patches over HTTP and tell clients which patches lead from a version to the latest\n" +
+		"    hash    print the version hash of a folder\n\n" +
+		"Run dirbsdiff <command> -h to see the options of a command\n\n" +
+		"Open source software used:\n\n" +
+		"    Pure Go bsdiff and bspatch libraries and CLI tools.\n" +
+		"        https://github.com/gabstv/go-bsdiff\n\n" +
+		"Written in Go, built with %s\n",
+	"-timeout 不能小于 0":                         "-timeout must not be negative",
+	"使用方法：\n\n    dirbsdiff %s %s\n\n选项：\n\n": "Usage:\n\n    dirbsdiff %s %s\n\nOptions:\n\n",
+	"多余的参数：%s，路径等参数都需要用选项指定，使用 dirbsdiff %s -h 查看选项": "unexpected arguments: %s, paths must be given with options, run dirbsdiff %s -h to see the options",
+	"缺少 -%s 选项":               "missing option -%s",
+	"-%s 路径 %s 不存在":           "-%s path %s does not exist",
+	"-%s 路径 %s 不是文件夹":         "-%s path %s is not a folder",
+	"获取 -%s 路径 %s 的绝对路径失败：%w": "failed to get the absolute path of -%s path %s: %w",
+	"创建文件夹 %s 失败：%w":          "failed to create folder %s: %w",
+	"%s 路径存在，但不是文件夹":          "%s exists but is not a folder",
+	"文件夹创建成功":                 "folder created",
+	"未知的子命令：%s\n\n%s":         "unknown command: %s\n\n%s",
+	"旧版文件夹路径":                 "old folder path",
+	"新版文件夹路径":                 "new folder path",
+	"新版文件夹路径，不存在则会自动创建":       "new folder path, created if it does not exist",
+	"差异文件夹路径":                 "patch folder path",
+	"差异文件夹路径，也可以是 http:// 或 https:// 地址，只下载需要的差异文件": "patch folder path, or an http:// or https:// URL from which only the needed payloads are downloaded",
+	"-diff 是 HTTP 地址时，每个文件请求失败或读取中断后的重试次数":          "when -diff is an HTTP URL, number of retries per file after a failed request or an interrupted read",
+	"第一次重试前的等待时间，之后每次加倍":                            "delay before the first retry, doubled for each further retry",
+	"-retries 不能是负数": "-retries must not be negative",
+	"copy 操作生成新版文件的方式：copy、hardlink 或 reflink，hardlink 和 reflink 失败时复制": "how copy operations create new files: copy, hardlink or reflink, falling back to copy if hardlink or reflink fails",
+	"先计算新版文件夹中已经存在的文件的 MD5，跳过已经是新版的文件，用于继续上次中断的补丁":                      "hash files already in the new folder first and skip those already up to date, for resuming an interrupted patch",
+	"-dir 补丁文件夹路径 [选项]":        "-dir patches_folder [options]",
+	"补丁文件夹路径，其中每个子文件夹是一个差异文件夹": "patches folder path, each subfolder of which is a patch folder",
+	"监听地址": "listen address",
+	"最新版本的版本哈希，为空时自动确定": "version hash of the latest version, determined automatically if empty",
+	"找到 %d 个补丁，最新版本：%s": "Found %d patches, latest version: %s",
+	"正在监听 %s":         "Listening on %s",
+	"服务器已停止":          "Server stopped",
+	"-dir 文件夹路径 [选项]": "-dir folder [options]",
+	"文件夹路径":           "folder path",
+	"gitignore 格式的排除规则文件，文件夹根目录下的 .bsdiffignore 文件会被自动读取": "gitignore-style exclude rule file, the .bsdiffignore file in the root of the folder is read automatically",
+	"输出差异文件夹路径，不存在则会自动创建":                                 "output patch folder path, created if it does not exist",
+	"指向新版文件夹之外的符号链接的处理方式：allow、skip 或 error":              "how to handle symlinks pointing outside the new folder: allow, skip or error",
+	"旧版文件夹：":        "Old folder:",
+	"新版文件夹：":        "New folder:",
+	"输出差异文件夹：":      "Output patch folder:",
+	"反向差异文件夹：":      "Reverse patch folder:",
+	"读取补丁描述文件错误：%w": "failed to read the patch manifest: %w",
+	"输出补丁描述文件错误：%w": "failed to write the patch manifest: %w",
+
+	"-old 旧文件夹路径 -new 新文件夹路径 -diff 差异文件夹路径 [选项]":                        "-old OLD_DIR -new NEW_DIR -diff PATCH_DIR [options]",
+	"-old 旧文件夹路径 -new 新文件夹路径 -out 差异文件夹路径 [选项]":                         "-old OLD_DIR -new NEW_DIR -out PATCH_DIR [options]",
+	"-old 旧文件夹路径 -new 新文件夹路径 -diff 差异文件夹路径1 -diff 差异文件夹路径2 ... [选项]":    "-old OLD_DIR -new NEW_DIR -diff PATCH_DIR1 -diff PATCH_DIR2 ... [options]",
+	"-old 旧文件夹路径 -out 输出差异文件夹路径 -diff 差异文件夹路径1 -diff 差异文件夹路径2 ... [选项]": "-old OLD_DIR -out OUTPUT_PATCH_DIR -diff PATCH_DIR1 -diff PATCH_DIR2 ... [options]",
+	"-diff 差异文件夹路径 -dir 文件夹路径 [选项]":                                     "-diff PATCH_DIR -dir DIR [options]",
+	"-diff 差异文件夹路径 [选项]":                                                "-diff PATCH_DIR [options]",
+	"差异文件夹路径或 HTTP 地址，按应用顺序重复指定，如 1→2、2→3、3→4":                          "patch folder path or HTTP URL, repeated in the order of application, such as 1→2, 2→3, 3→4",
+	"全部补丁应用成功":            "all patches applied",
+	"旧版文件夹名称 %s 重复":       "duplicate old folder name %s",
+	"旧版文件夹名称不能是 %s":       "an old folder cannot be named %s",
+	"文件分块大小，如 64MiB、1GiB": "file chunk size, such as 64MiB or 1GiB",
+	"同时生成从新版还原到旧版的反向补丁的差异文件夹路径，复用同一次扫描结果，用于回滚":                                                      "also generate a reverse patch from the new folder back to the old one into this folder, reusing the same scan, for rollbacks",
+	"额外的旧版文件夹，可以重复指定，为 -old 和每个 -base 各生成一个补丁，放在差异文件夹中以旧版文件夹名称命名的子文件夹中，差异文件按内容去重保存在 payloads 子文件夹中": "additional old folder, can be repeated; a patch is generated for -old and every -base into a subfolder of the patch folder named after the old folder, and payloads are deduplicated by content in the payloads subfolder",
+	"gitignore 风格的排除规则，可以重复指定":                                 "gitignore style exclude pattern, can be repeated",
+	"gitignore 风格的包含规则，可以重复指定，指定后只扫描匹配的文件":                     "gitignore style include pattern, can be repeated; when given only matching files are scanned",
+	"gitignore 格式的排除规则文件，旧版和新版文件夹根目录下的 .bsdiffignore 文件会被自动读取": "gitignore format exclude file; .bsdiffignore files in the roots of the old and new folders are read automatically",
+	"MD5 缓存文件，文件大小、修改时间、inode 都未改变的文件直接使用缓存的 MD5":              "MD5 cache file; files whose size, modification time and inode are unchanged use the cached MD5",
+	"同时计算 MD5 的协程数量，旧版和新版文件夹共用":                                "number of goroutines computing MD5, shared by the old and new folders",
+	"-bulk-size %s 超出范围，必须大于 0 且不超过 %s":                        "-bulk-size %s is out of range, it must be greater than 0 and at most %s",
+	"应用补丁的机器的内存预算，如 1GiB，指定后按内存预算为每个文件选择分块大小：不超过最大分块大小的文件不分块，更大的文件平均分块，不能与 -bulk-size 同时使用": "memory budget of the patching machine, such as 1GiB; when set, the chunk size is chosen per file: files not larger than the maximum chunk size are not chunked, larger files are split into equal chunks; cannot be used with -bulk-size",
+	"-memory-budget 不能是负数":               "-memory-budget must not be negative",
+	"-bulk-size 不能与 -memory-budget 同时使用": "-bulk-size cannot be used with -memory-budget",
+	"-memory-budget %s 太小":               "-memory-budget %s is too small",
+	"按内存预算 %s 选择分块大小，最大分块大小：%s":          "Choosing chunk sizes for memory budget %s, maximum chunk size: %s",
+	"-workers %d 必须大于 0":                 "-workers %d must be greater than 0",
+	"-reverse 不能与 -base 同时使用":            "-reverse cannot be used together with -base",
+	"反向差异文件夹不能与输出差异文件夹相同":                "the reverse patch folder cannot be the output patch folder",
+	"读取排除规则错误：%w":                        "failed to read exclude rules: %w",
+	"读取 MD5 缓存错误：%w":                     "failed to read the MD5 cache: %w",
+	"正在扫描旧版和新版文件夹全部文件":                   "Scanning all files in the old and new folders",
+	"扫描文件夹错误：%w":                         "failed to scan folders: %w",
+	"MD5 缓存命中 %d 个文件，重新计算 %d 个文件":        "MD5 cache hit for %d files, recomputed %d files",
+	"保存 MD5 缓存错误：%w":                     "failed to save the MD5 cache: %w",
+	"创建差异文件存储失败：%w":                      "failed to create the payload store: %w",
+	"正在生成补丁：":                            "Generating patch:",
+	"正在生成反向补丁：":                          "Generating reverse patch:",
+	"文件\t操作\t新版文件大小\t差异文件大小\t比例":         "File\tOperation\tNew size\tPayload size\tRatio",
+	"分 %d 块":                 "%d chunks",
+	"  第 %d 块\t%s\t\t%s\t\n": "  chunk %d\t%s\t\t%s\t\n",
+	"操作\t数量\t差异文件大小":         "Operation\tCount\tPayload size",
+	"补丁描述文件版本：":              "Manifest version:",
+	"旧版版本哈希：":                "Old version hash:",
+	"新版版本哈希：":                "New version hash:",
+	"分块大小：":                  "Chunk size:",
+	"文件数量：":                  "Files:",
+	"符号链接数量：":                "Symlinks:",
+	"文件夹数量：%d，删除文件夹数量：%d\n":  "Folders: %d, removed folders: %d\n",
+	"新版文件总大小：":               "Total new size:",
+	"差异文件总大小：":               "Total payload size:",
+	"比例：":                    "Ratio:",
+	"以 JSON 格式输出":            "output as JSON",
+	"、":                      ", ",
+	"差异算法：":                  "diff algorithm: ",
+	"，auto 对每一块尝试全部差异算法和压缩算法，保留最小的结果": "; auto tries every diff and compression algorithm for each chunk and keeps the smallest result",
+	"新增文件和新文件数据块的压缩算法：":               "compression algorithm for added files and new data chunks: ",
+	"zstd 压缩等级 1~22": "zstd compression level 1-22",
+	"旧文件或新文件不小于这个大小时使用 zstd patch-from 模式，如 512MiB，0 表示不使用": "use zstd patch-from mode when the old or new file is at least this size, such as 512MiB; 0 disables it",
+	"-zstd-level %d 超出范围，必须是 1~22":                          "-zstd-level %d is out of range, it must be 1-22",
+	"-patch-from-size 不能是负数":                                "-patch-from-size cannot be negative",
+	"第一个补丁的旧版文件夹路径":                                         "old folder path of the first patch",
+	"要合并的差异文件夹路径，按应用顺序重复指定":                                 "patch folder path to merge, repeated in the order of application",
+	"输出差异路径 %s 不能是要合并的补丁":                                   "output patch path %s cannot be one of the patches to merge",
+	"合并成功":      "patches merged",
+	"要检查的文件夹路径": "folder path to check",
+	"old 检查文件夹能否应用补丁，new 检查文件夹是否与补丁生成的新版一致": "old checks whether the folder can take the patch, new checks whether the folder matches the patch result",
+	"-side %s 无效，必须是 old 或 new":             "invalid -side %s, it must be old or new",
+	"缺少":  "Missing",
+	"不一致": "Mismatched",
+	"校验失败：共检查 %d 项，缺少 %d 项，不一致 %d 项": "verification failed: checked %d entries, %d missing, %d mismatched",
+	"校验通过，共检查 %d 项":                  "Verification passed, checked %d entries",
+
+	// delta
+	"bsdiff 旧数据大小 %d 超过 2 GB":               "bsdiff old data size %d exceeds 2 GB",
+	"未知的压缩算法：%s":                            "unknown compression algorithm: %s",
+	"未知的差异算法：%s":                            "unknown diff algorithm: %s",
+	"VCDIFF 地址模式 %d 无效":                     "invalid VCDIFF address mode %d",
+	"VCDIFF 复制地址 %d 超出范围":                   "VCDIFF copy address %d out of range",
+	"VCDIFF 数据意外结束":                         "unexpected end of VCDIFF data",
+	"VCDIFF 整数过大":                           "VCDIFF integer too large",
+	"不是 VCDIFF 格式":                          "not VCDIFF data",
+	"不支持 VCDIFF 二级压缩":                       "VCDIFF secondary compression is not supported",
+	"不支持 VCDIFF 自定义指令表":                     "VCDIFF custom code tables are not supported",
+	"不支持 VCDIFF VCD_TARGET 窗口":              "VCDIFF VCD_TARGET windows are not supported",
+	"VCDIFF 源数据段超出旧版数据范围":                   "VCDIFF source segment exceeds the old data",
+	"VCDIFF 目标窗口长度超出声明的长度":                  "VCDIFF target window exceeds the declared length",
+	"VCDIFF 目标窗口长度 %d 超出范围":                 "VCDIFF target window length %d is out of range",
+	"VCDIFF 目标窗口长度与声明的长度不一致":                "VCDIFF target window length does not match the declared length",
+	"VCDIFF 目标窗口校验和不一致":                     "VCDIFF target window checksum mismatch",
+	"zstd patch-from 差异数据已损坏":               "zstd patch-from data is corrupt",
+	"zstd patch-from 字典范围 %d+%d 超出旧数据大小 %d": "zstd patch-from dictionary range %d+%d exceeds the old data size %d",
+
+	// diff
+	"执行 %s 压缩错误：%w":             "%s compression failed: %w",
+	"执行 %s 错误：%w":               "%s failed: %w",
+	"写入差异文件错误：%w":               "failed to write payload: %w",
+	"复制文件错误：%w":                 "failed to copy file: %w",
+	"获取旧版文件大小错误：%w":             "failed to get old file size: %w",
+	"获取新版文件大小错误：%w":             "failed to get new file size: %w",
+	"打开旧版文件错误：%w":               "failed to open old file: %w",
+	"打开新版文件错误：%w":               "failed to open new file: %w",
+	"读取旧版文件错误：%w":               "failed to read old file: %w",
+	"读取新版文件错误：%w":               "failed to read new file: %w",
+	"第 %d 块文件计算差异错误：%w":         "failed to diff chunk %d: %w",
+	"写入第 %d 块文件错误：%w":           "failed to write chunk %d: %w",
+	"创建差异文件错误：%w":               "failed to create payload: %w",
+	"执行 zstd patch-from 错误：%w":  "zstd patch-from failed: %w",
+	"获取差异文件大小错误：%w":             "failed to get payload size: %w",
+	"删除差异文件错误：%w":               "failed to remove payload: %w",
+	"正在列举未修改和新增文件":              "Listing unchanged and added files",
+	"差异文件列表":                    "Changed files",
+	"符号链接列表":                    "Symlinks",
+	"跳过指向文件夹之外的符号链接":            "Skipping symlink pointing outside the folder",
+	"符号链接指向文件夹之外：%s -> %s":      "symlink points outside the folder: %s -> %s",
+	"文件夹列表":                     "Folders",
+	"正在复制新文件":                   "Copying new files",
+	"新文件已在存储中":                  "new file already in the store",
+	"%s 创建文件夹失败：%w":             "%s failed to create folder: %w",
+	"创建文件夹成功":                   "folder created",
+	"%s 路径已存在，但不是文件":            "%s exists but is not a file",
+	"%s 复制新文件错误：%w":             "%s failed to copy new file: %w",
+	"复制成功":                      "copied",
+	"正在计算文件差异":                  "Computing file differences",
+	"%s 获取文件大小错误：%w":            "%s failed to get file size: %w",
+	"正在使用 zstd patch-from 计算差异": "diffing with zstd patch-from",
+	"正在计算差异":                    "diffing",
+	"%s 计算文件差异错误：%w":            "%s failed to diff file: %w",
+	"差异计算完成":                    "diff done",
+	"正在生成补丁描述文件":                "Generating patch manifest",
+	"%s 获取新版文件大小错误：%w":          "%s failed to get new file size: %w",
+	"正在移动差异文件到存储":               "Moving payloads to the store",
+	"补丁描述文件生成成功":                "Patch manifest generated",
+	"没有指定补丁":                    "no patches given",
+	"读取第 %d 个补丁描述文件错误：%w":       "failed to read manifest of patch %d: %w",
+	"创建临时文件夹错误：%w":              "failed to create temporary folder: %w",
+	"%s 合并错误：%w":                "%s failed to merge: %w",
+	"第 %d 个补丁中没有这个文件":           "file is missing from patch %d",
+	"第 1 个补丁中没有旧版文件的 md5":       "patch 1 has no md5 for the old file",
+	"未修改": "unchanged",
+	"%s 只在第 %d 个补丁中修改，复制差异文件": "%s changed only in patch %d, copying payload",
+	"逐块合并的结果不正确，重新计算整个文件":     "chunk-wise merge result is incorrect, recomputing the whole file",
+	"复制差异文件 %s 错误：%w":         "failed to copy payload %s: %w",
+	"%s 修改了 %d 次，重新计算差异":      "%s changed %d times, recomputing the diff",
+	"生成新文件错误：%w":              "failed to generate new file: %w",
+	"检查合并结果错误：%w":             "failed to check merge result: %w",
+	"%s 逐块合并完成，重新计算了 %d 块":    "%s merged chunk by chunk, recomputed %d chunks",
+	"%s 移动差异文件到存储错误：%w":       "%s failed to move payload to the store: %w",
+
+	// patch
+	"差异文件夹地址 %s 无效：%w":                    "invalid patch folder URL %s: %w",
+	"差异文件夹地址 %s 无效：只支持 http 和 https":      "invalid patch folder URL %s: only http and https are supported",
+	"请求 %s 错误：%s":                         "request %s failed: %s",
+	"%s 读取错误，%s 后第 %d 次重试：%v":             "%s read failed, retry %[3]d in %[2]s: %[4]v",
+	"%s 在读取过程中被修改或服务器不支持 Range 请求，无法继续读取": "%s changed while reading or the server does not support range requests, cannot resume",
+	"%s 返回的 Content-Range 无效：%s":          "%s returned an invalid Content-Range: %s",
+	"旧版文件 md5 不正确":                        "old file md5 mismatch",
+	"新版文件 md5 不正确":                        "new file md5 mismatch",
+	"差异文件不存在":                             "payload is missing",
+	"差异文件已损坏":                             "payload is corrupt",
+	"补丁描述文件无效":                            "invalid patch manifest",
+	"补丁不能连续应用":                            "patches cannot be applied in sequence",
+	"：":                                   ": ",
+	"%s 文件 md5 计算错误：%w":                   "%s failed to compute md5: %w",
+	"%s 操作为空":                             "%s has an empty operation",
+	"%s 更新文件失败：%w":                        "%s failed to update file: %w",
+	"更新文件成功":                              "file updated",
+	"%s 复制文件错误：%w":                        "%s failed to copy file: %w",
+	"%s 未知操作 %s":                          "%s unknown operation %s",
+	"读取旧文件失败：%w":                          "failed to read old file: %w",
+	"读取差异文件失败：%w":                         "failed to read payload: %w",
+	"写入新文件失败：%w":                          "failed to write new file: %w",
+	"%s 路径已存在，但不是符号链接":                    "%s exists but is not a symlink",
+	"%s 删除已存在的文件失败：%w":                    "%s failed to remove existing file: %w",
+	"%s 创建临时文件失败：%w":                      "%s failed to create temporary file: %w",
+	"%s 重命名临时文件失败：%w":                     "%s failed to rename temporary file: %w",
+	"新版文件夹 %s 不能与旧版文件夹相同":                 "new folder %s must not be the same as the old folder",
+	"新版文件夹 %s 不能在旧版文件夹 %s 中":              "new folder %s must not be inside old folder %s",
+	"旧版文件夹 %s 不能在新版文件夹 %s 中":              "old folder %s must not be inside new folder %s",
+	"%s 创建符号链接失败：%w":                      "%s failed to create symlink: %w",
+	"创建符号链接成功":                            "symlink created",
+	"%s 读取文件夹信息失败：%w":                     "%s failed to stat folder: %w",
+	"%s 读取文件夹失败：%w":                       "%s failed to read folder: %w",
+	"文件夹不为空，保留":                           "folder is not empty, keeping it",
+	"%s 删除文件夹失败：%w":                       "%s failed to remove folder: %w",
+	"删除文件夹成功":                             "folder removed",
+	"打开新文件失败：%w":                          "failed to open new file: %w",
+	"打开旧文件失败：%w":                          "failed to open old file: %w",
+	"第 %d 块复制旧文件失败：%w":                    "chunk %d failed to copy old file: %w",
+	"第 %d 块跳过旧文件失败：%w":                    "chunk %d failed to skip old file: %w",
+	"第 %d 块复制新文件失败：%w":                    "chunk %d failed to copy new data: %w",
+	"第 %d 块更新失败：%w":                       "chunk %d failed to patch: %w",
+	"第 %d 块未知操作 %s":                       "chunk %d unknown operation %s",
+	"第 %d 个补丁需要的旧版文件 %s 不在第 %d 个补丁生成的文件中":      "old file %[2]s required by patch %[1]d is not produced by patch %[3]d",
+	"第 %d 个补丁需要的旧版文件 %s 的 md5 与第 %d 个补丁生成的不一致": "md5 of old file %[2]s required by patch %[1]d does not match the one produced by patch %[3]d",
+	"正在应用第 %d 个补丁：%s":                          "Applying patch %d: %s",
+	"删除临时文件夹错误：%w":                             "failed to remove temporary folder: %w",
+	"应用第 %d 个补丁错误：%w":                          "failed to apply patch %d: %w",
+	"%s 读取差异文件信息错误：%w":                         "%s failed to stat payload: %w",
+	"未知的符号链接策略：%s":                             "unknown symlink policy: %s",
+	"未知的复制方式：%s":                               "unknown copy mode: %s",
+	"zero 操作的字节数无效：%s":                         "invalid byte count of zero operation: %s",
+	"%s 生成全零文件错误：%w":                           "%s failed to create zero file: %w",
+	"生成全零文件成功":                                 "zero file created",
+	"第 %d 块写入空洞失败：%w":                          "chunk %d failed to write hole: %w",
+	"创建硬链接成功":                                  "hardlink created",
+	"reflink 成功":                               "reflinked",
+	"已经是新版，跳过":                                 "already up to date, skipped",
+	"跳过 %d 个已经是新版的文件":                          "Skipped %d files already up to date",
+	"%s 读取文件信息失败：%w":                           "%s failed to stat file: %w",
+	"没有从这个版本开始的补丁":                             "no patch starts from this version",
+	"没有版本哈希，跳过":                                "has no version hash, skipped",
+	"查找补丁错误：%w":                                "failed to find patches: %w",
+	"无法确定最新版本，有 %d 个候选版本，需要指定最新版本":             "cannot determine the latest version, there are %d candidates, the latest version must be specified",
+	"缺少 from 参数":                               "missing from parameter",
+
+	// util
+	"文件不存在：%w":            "file does not exist: %w",
+	"此路径不是文件：%w":          "path is not a file: %w",
+	"读取 MD5 缓存文件错误：%w":    "failed to read MD5 cache file: %w",
+	"MD5 缓存文件格式错误：%w":     "invalid MD5 cache file: %w",
+	"MD5 缓存编码错误：%w":       "failed to encode MD5 cache: %w",
+	"创建 MD5 缓存临时文件错误：%w":  "failed to create temporary MD5 cache file: %w",
+	"写入 MD5 缓存文件错误：%w":    "failed to write MD5 cache file: %w",
+	"打开排除规则文件错误：%w":       "failed to open exclude file: %w",
+	"读取排除规则文件错误：%w":       "failed to read exclude file: %w",
+	"计算文件 MD5 时打开文件错误：%w": "failed to open file for MD5: %w",
+	"计算文件 MD5 时读取文件错误：%w": "failed to read file for MD5: %w",
+	"遍历目录全部文件错误：%w":       "failed to walk folder: %w",
+	"路径 %s 不在 %s 中：%w":    "path %s is not inside %s: %w",
+	"读取符号链接 %s 错误：%w":     "failed to read symlink %s: %w",
+	"大小 %s 不能是负数":         "size %s cannot be negative",
+	"大小 %s 太大":            "size %s is too large",
+	"无法解析大小 %s":           "cannot parse size %s",
+}
@@ -0,0 +1,86 @@
+// Package i18n 是界面文字的翻译目录，源代码中的中文文字即为翻译的键
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Lang 是界面语言
+type Lang string
+
+const (
+	Chinese Lang = "zh"
+	English Lang = "en"
+)
+
+var catalogues = map[Lang]map[string]string{
+	English: english,
+}
+
+var current = Chinese
+
+// SetLang 设置界面语言，应当在输出任何文字之前调用
+func SetLang(lang Lang) {
+	current = lang
+}
+
+// CurrentLang 返回当前的界面语言
+func CurrentLang() Lang {
+	return current
+}
+
+// ParseLang 解析语言名称，支持 zh、en 以及 zh_CN.UTF-8、en_US 这样的 locale 名称
+func ParseLang(name string) (Lang, error) {
+	name = strings.ToLower(name)
+	if i := strings.IndexAny(name, "_-.@"); i >= 0 {
+		name = name[:i]
+	}
+	switch Lang(name) {
+	case Chinese, English:
+		return Lang(name), nil
+	}
+	return "", fmt.Errorf(T("不支持的语言 %s，可用的语言：zh、en"), name)
+}
+
+// DetectLang 按 LC_ALL、LC_MESSAGES、LANG 的顺序从环境变量中检测界面语言
+//
+// 第一个非空的环境变量决定语言，C 和 POSIX 使用英文，都没有设置或者无法识别时使用中文
+func DetectLang() Lang {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		if value == "C" || value == "POSIX" || strings.HasPrefix(value, "C.") {
+			return English
+		}
+		if lang, err := ParseLang(value); err == nil {
+			return lang
+		}
+		return Chinese
+	}
+	return Chinese
+}
+
+// T 返回文字在当前界面语言中的翻译，没有翻译时原样返回
+func T(s string) string {
+	if catalogue, ok := catalogues[current]; ok {
+		if translated, ok := catalogue[s]; ok {
+			return translated
+		}
+	}
+	return s
+}
+
+type lazyError string
+
+func (e lazyError) Error() string {
+	return T(string(e))
+}
+
+// Error 返回在调用 Error() 时才翻译的错误，用于包级别的错误变量
+func Error(s string) error {
+	return lazyError(s)
+}
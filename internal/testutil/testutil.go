@@ -0,0 +1,65 @@
+// Package testutil 是各个包的测试共用的辅助函数
+package testutil
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+// Main 丢弃日志输出后运行测试，在各个包的 TestMain 中调用
+func Main(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// WriteFiles 在 dirAbsPath 中写入文件，files 的键是使用 / 分隔的相对路径
+func WriteFiles(t testing.TB, dirAbsPath string, files map[string][]byte) {
+	t.Helper()
+	for name, content := range files {
+		filePath := filepath.Join(dirAbsPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func RandomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+// ScanDirs 扫描文件夹，不使用排除规则和 MD5 缓存
+func ScanDirs(t testing.TB, dirAbsPaths ...string) []*util.DirScanResult {
+	t.Helper()
+	scans, err := util.ScanDirs(context.Background(), dirAbsPaths, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scans
+}
+
+// AssertSameDir 检查两个文件夹中的普通文件完全相同
+func AssertSameDir(t testing.TB, wantDirAbsPath, gotDirAbsPath string) {
+	t.Helper()
+	scans := ScanDirs(t, wantDirAbsPath, gotDirAbsPath)
+	want, got := scans[0].Files, scans[1].Files
+	if len(want) != len(got) {
+		t.Errorf("文件数量 %d，期望 %d", len(got), len(want))
+	}
+	for name, md5 := range want {
+		if got[name] != md5 {
+			t.Errorf("%s 的 md5 为 %q，期望 %q", name, got[name], md5)
+		}
+	}
+}
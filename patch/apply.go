@@ -0,0 +1,645 @@
+package patch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ganlvtech/go-dir-bsdiff/delta"
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+type ApplyOptions struct {
+	// SymlinkPolicy 决定如何处理指向新版文件夹之外的符号链接，为空时与 SymlinkPolicyAllow 相同
+	SymlinkPolicy SymlinkPolicy
+	// SkipExisting 为 true 时先计算新版文件夹中已经存在的文件的 MD5，跳过已经是新版的文件，如上次中断的补丁已经生成的文件
+	SkipExisting bool
+	// CopyMode 决定如何生成 copy 操作的新版文件，为空时与 CopyModeCopy 相同
+	CopyMode CopyMode
+}
+
+// ReadManifest 读取差异文件夹中的补丁描述文件
+func ReadManifest(diffDirAbsPath string) (*Manifest, error) {
+	return ReadSourceManifest(context.Background(), DirSource(diffDirAbsPath))
+}
+
+// ReadSourceManifest 从 source 读取补丁描述文件
+func ReadSourceManifest(ctx context.Context, source Source) (*Manifest, error) {
+	manifestPath := source.Location(ManifestFileName)
+	r, err := source.Open(ctx, ManifestFileName)
+	if os.IsNotExist(err) {
+		return nil, &Error{Kind: ErrInvalidManifest, Path: manifestPath, Err: err}
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, &Error{Kind: ErrInvalidManifest, Path: manifestPath, Err: err}
+	}
+	return manifest, nil
+}
+
+// WriteManifest 把补丁描述文件写入差异文件夹
+func WriteManifest(diffDirAbsPath string, manifest *Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(diffDirAbsPath, ManifestFileName), data, 0644)
+}
+
+// NewTreeMd5 返回应用补丁后新版文件夹全部文件的 MD5，包括直接复制的旧文件
+func (m *Manifest) NewTreeMd5() map[string]string {
+	result := make(map[string]string, len(m.Patches))
+	for fileName, operation := range m.Patches {
+		if fileMD5, ok := m.NewMd5[fileName]; ok {
+			result[fileName] = fileMD5
+		} else if operation == OperationTypeCopyOld {
+			result[fileName] = m.OldMd5[fileName]
+		}
+	}
+	return result
+}
+
+func mkdir(dirPath string) error {
+	if mkdirResult, err := util.MkdirIfNotExists(dirPath); err != nil {
+		return fmt.Errorf(i18n.T("%s 创建文件夹失败：%w"), dirPath, err)
+	} else if mkdirResult == util.MkdirIfNotExistsResultExistsFile {
+		return fmt.Errorf(i18n.T("%s 路径存在，但不是文件夹"), dirPath)
+	}
+	return nil
+}
+
+// Apply 读取 diffDirAbsPath 中的补丁描述文件，把旧版文件夹更新到新版文件夹
+func Apply(ctx context.Context, oldDirAbsPath, newDirAbsPath, diffDirAbsPath string, options *ApplyOptions) error {
+	return ApplySource(ctx, DirSource(diffDirAbsPath), oldDirAbsPath, newDirAbsPath, options)
+}
+
+// ApplySource 从 source 读取补丁描述文件，把旧版文件夹更新到新版文件夹，只读取需要的差异文件
+func ApplySource(ctx context.Context, source Source, oldDirAbsPath, newDirAbsPath string, options *ApplyOptions) error {
+	manifest, err := ReadSourceManifest(ctx, source)
+	if err != nil {
+		return fmt.Errorf(i18n.T("读取补丁描述文件错误：%w"), err)
+	}
+	return ApplyManifest(ctx, manifest, oldDirAbsPath, newDirAbsPath, source, options)
+}
+
+// ApplyManifest 按补丁描述文件把旧版文件夹更新到新版文件夹，先校验旧版文件，最后校验新版文件
+//
+// 旧版和新版文件夹不能相同或互相包含，见 CheckDirs。每个文件开始前检查 ctx，取消后返回 ctx 的错误，正在写入的新文件会被删除。
+// options.SkipExisting 为 true 时跳过的文件不再校验旧版文件和新版文件。
+func ApplyManifest(ctx context.Context, manifest *Manifest, oldDirAbsPath, newDirAbsPath string, source Source, options *ApplyOptions) error {
+	if err := CheckDirs(oldDirAbsPath, newDirAbsPath); err != nil {
+		return err
+	}
+	if options == nil {
+		options = &ApplyOptions{}
+	}
+	skipped := make(map[string]bool)
+	if options.SkipExisting {
+		newTreeMd5 := manifest.NewTreeMd5()
+		for fileName := range manifest.Patches {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			upToDate, err := isUpToDate(filepath.Join(newDirAbsPath, fileName), newTreeMd5[fileName])
+			if err != nil {
+				return err
+			}
+			if upToDate {
+				skipped[fileName] = true
+				log.Println(fileName, i18n.T("已经是新版，跳过"))
+			}
+		}
+		log.Printf(i18n.T("跳过 %d 个已经是新版的文件"), len(skipped))
+	}
+	for fileName, fileMD5 := range manifest.OldMd5 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skipped[fileName] {
+			continue
+		}
+		oldFilePath := filepath.Join(oldDirAbsPath, fileName)
+		oldFileMD5, err := util.FileMD5(oldFilePath)
+		if errors.Is(err, os.ErrNotExist) {
+			return &Error{Kind: ErrOldHashMismatch, Path: oldFilePath, Err: err}
+		} else if err != nil {
+			return fmt.Errorf(i18n.T("%s 文件 md5 计算错误：%w"), oldFilePath, err)
+		}
+		if oldFileMD5 != fileMD5 {
+			return &Error{Kind: ErrOldHashMismatch, Path: oldFilePath}
+		}
+	}
+	for _, dirName := range manifest.Dirs {
+		if err := mkdir(filepath.Join(newDirAbsPath, dirName)); err != nil {
+			return err
+		}
+	}
+	for fileName, operation := range manifest.Patches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skipped[fileName] {
+			continue
+		}
+		if err := ApplyFile(ctx, manifest, oldDirAbsPath, newDirAbsPath, source, fileName, operation, options.CopyMode); err != nil {
+			return err
+		}
+	}
+	for linkName, target := range manifest.Symlinks {
+		if err := CreateSymlink(newDirAbsPath, linkName, target, options.SymlinkPolicy); err != nil {
+			return err
+		}
+	}
+	if err := RemoveDirs(newDirAbsPath, manifest.RemovedDirs); err != nil {
+		return err
+	}
+	for fileName, fileMD5 := range manifest.NewMd5 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skipped[fileName] {
+			continue
+		}
+		newFilePath := filepath.Join(newDirAbsPath, fileName)
+		newFileMD5, err := util.FileMD5(newFilePath)
+		if errors.Is(err, os.ErrNotExist) {
+			return &Error{Kind: ErrNewHashMismatch, Path: newFilePath, Err: err}
+		} else if err != nil {
+			return fmt.Errorf(i18n.T("%s 文件 md5 计算错误：%w"), newFilePath, err)
+		}
+		if newFileMD5 != fileMD5 {
+			return &Error{Kind: ErrNewHashMismatch, Path: newFilePath}
+		}
+	}
+	return nil
+}
+
+// isUpToDate 判断新版文件是否已经存在且 MD5 为 fileMD5，符号链接不算
+func isUpToDate(newFilePath string, fileMD5 string) (bool, error) {
+	if fileMD5 == "" {
+		return false, nil
+	}
+	fileInfo, err := os.Lstat(newFilePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf(i18n.T("%s 读取文件信息失败：%w"), newFilePath, err)
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return false, nil
+	}
+	newFileMD5, err := util.FileMD5(newFilePath)
+	if err != nil {
+		return false, fmt.Errorf(i18n.T("%s 文件 md5 计算错误：%w"), newFilePath, err)
+	}
+	return newFileMD5 == fileMD5, nil
+}
+
+// ApplyFile 按一个文件的操作生成新版文件，差异文件从 source 读取，copy 操作按 copyMode 生成
+//
+// 新版文件先写入同一文件夹中的临时文件，完成后重命名为新版文件，已经存在的新版文件是旧版文件的硬链接时只是被替换，旧版文件不变。
+// 旧版和新版文件夹不能相同或互相包含，见 CheckDirs
+func ApplyFile(ctx context.Context, manifest *Manifest, oldDirAbsPath, newDirAbsPath string, source Source, fileName string, operation string, copyMode CopyMode) error {
+	oldFilePath := filepath.Join(oldDirAbsPath, fileName)
+	newFilePath := filepath.Join(newDirAbsPath, fileName)
+	if err := mkdir(filepath.Dir(newFilePath)); err != nil {
+		return err
+	}
+	if operation == "" {
+		return &Error{Kind: ErrInvalidManifest, Err: fmt.Errorf(i18n.T("%s 操作为空"), fileName)}
+	}
+	partOperations := ParseOperation(operation)
+	tempFilePath, err := tempFileName(filepath.Dir(newFilePath))
+	if err != nil {
+		return fmt.Errorf(i18n.T("%s 创建临时文件失败：%w"), fileName, err)
+	}
+	// 出错时删除写了一半的临时文件。临时文件和新版文件互为硬链接时重命名不会生效，临时文件也需要删除
+	defer os.Remove(tempFilePath)
+	message, err := writeNewFile(ctx, manifest, tempFilePath, oldFilePath, source, fileName, partOperations, copyMode)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tempFilePath, newFilePath); err != nil {
+		return fmt.Errorf(i18n.T("%s 重命名临时文件失败：%w"), fileName, err)
+	}
+	log.Println(fileName, message)
+	return nil
+}
+
+// tempFileName 返回 dirPath 中一个不存在的临时文件路径，由写入的函数创建
+func tempFileName(dirPath string) (string, error) {
+	f, err := os.CreateTemp(dirPath, ".bsdiff-apply-*")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), os.Remove(f.Name())
+}
+
+// writeNewFile 按一个文件的操作把新版文件写入 newFilePath，返回成功时输出的日志
+func writeNewFile(ctx context.Context, manifest *Manifest, newFilePath, oldFilePath string, source Source, fileName string, partOperations []PartOperation, copyMode CopyMode) (string, error) {
+	if len(partOperations) > 1 {
+		if err := AutoPartPatch(ctx, manifest, newFilePath, oldFilePath, source, fileName, partOperations); err != nil {
+			return "", fmt.Errorf(i18n.T("%s 更新文件失败：%w"), fileName, err)
+		}
+		return i18n.T("更新文件成功"), nil
+	}
+	partOperation := partOperations[0]
+	payloadName := manifest.PayloadName(fileName, 0, partOperation)
+	switch partOperation.Type {
+	case OperationTypeCopyOld:
+		usedMode, err := CopyOld(ctx, newFilePath, oldFilePath, copyMode)
+		if err != nil {
+			return "", fmt.Errorf(i18n.T("%s 复制文件错误：%w"), fileName, err)
+		}
+		switch usedMode {
+		case CopyModeHardlink:
+			return i18n.T("创建硬链接成功"), nil
+		case CopyModeReflink:
+			return i18n.T("reflink 成功"), nil
+		default:
+			return i18n.T("复制成功"), nil
+		}
+	case OperationTypeCopyNew:
+		if err := CopyNew(ctx, newFilePath, source, payloadName, partOperation.Argument); err != nil {
+			return "", fmt.Errorf(i18n.T("%s 复制文件错误：%w"), fileName, err)
+		}
+		return i18n.T("复制成功"), nil
+	case OperationTypePatch:
+		if err := PatchFile(ctx, newFilePath, oldFilePath, source, payloadName, partOperation.Codec()); err != nil {
+			return "", fmt.Errorf(i18n.T("%s 更新文件失败：%w"), fileName, err)
+		}
+		return i18n.T("更新文件成功"), nil
+	case OperationTypePatchFrom:
+		if err := PatchFrom(ctx, newFilePath, oldFilePath, source, payloadName); err != nil {
+			return "", fmt.Errorf(i18n.T("%s 更新文件失败：%w"), fileName, err)
+		}
+		return i18n.T("更新文件成功"), nil
+	case OperationTypeZero:
+		size, err := partOperation.ZeroSize()
+		if err != nil {
+			return "", &Error{Kind: ErrInvalidManifest, Err: fmt.Errorf("%s %w", fileName, err)}
+		}
+		if err := CreateZeroFile(newFilePath, size); err != nil {
+			return "", fmt.Errorf(i18n.T("%s 生成全零文件错误：%w"), fileName, err)
+		}
+		return i18n.T("生成全零文件成功"), nil
+	default:
+		return "", &Error{Kind: ErrInvalidManifest, Err: fmt.Errorf(i18n.T("%s 未知操作 %s"), fileName, partOperation)}
+	}
+}
+
+// CopyOld 按 copyMode 用旧文件生成新文件，创建硬链接或 reflink 失败时复制，返回实际使用的方式
+func CopyOld(ctx context.Context, newFilePath, oldFilePath string, copyMode CopyMode) (CopyMode, error) {
+	switch copyMode {
+	case CopyModeHardlink:
+		if err := util.LinkFile(newFilePath, oldFilePath); err == nil {
+			return CopyModeHardlink, nil
+		}
+	case CopyModeReflink:
+		if err := util.ReflinkFile(newFilePath, oldFilePath); err == nil {
+			return CopyModeReflink, nil
+		}
+	}
+	return CopyModeCopy, util.CopyFileContext(ctx, newFilePath, oldFilePath)
+}
+
+// CheckDirs 检查旧版和新版文件夹不是同一个文件夹，也不互相包含，否则写入新版文件时可能修改还没有读取的旧版文件
+func CheckDirs(oldDirAbsPath, newDirAbsPath string) error {
+	oldDirAbsPath = filepath.Clean(oldDirAbsPath)
+	newDirAbsPath = filepath.Clean(newDirAbsPath)
+	if oldDirAbsPath == newDirAbsPath || isSameFile(oldDirAbsPath, newDirAbsPath) {
+		return fmt.Errorf(i18n.T("新版文件夹 %s 不能与旧版文件夹相同"), newDirAbsPath)
+	}
+	if isSubDir(oldDirAbsPath, newDirAbsPath) {
+		return fmt.Errorf(i18n.T("新版文件夹 %s 不能在旧版文件夹 %s 中"), newDirAbsPath, oldDirAbsPath)
+	}
+	if isSubDir(newDirAbsPath, oldDirAbsPath) {
+		return fmt.Errorf(i18n.T("旧版文件夹 %s 不能在新版文件夹 %s 中"), oldDirAbsPath, newDirAbsPath)
+	}
+	return nil
+}
+
+// isSubDir 判断 dirAbsPath 是否在 parentAbsPath 中
+func isSubDir(parentAbsPath, dirAbsPath string) bool {
+	relPath, err := filepath.Rel(parentAbsPath, dirAbsPath)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// isSameFile 判断两个路径是否是同一个文件，如互为硬链接，任一不存在时返回 false
+func isSameFile(path1, path2 string) bool {
+	fileInfo1, err := os.Lstat(path1)
+	if err != nil {
+		return false
+	}
+	fileInfo2, err := os.Lstat(path2)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fileInfo1, fileInfo2)
+}
+
+// openPayload 从 source 打开差异文件，差异文件不存在时返回 ErrPayloadMissing
+func openPayload(ctx context.Context, source Source, payloadName string) (io.ReadCloser, error) {
+	r, err := source.Open(ctx, payloadName)
+	if err != nil {
+		return nil, payloadError(source.Location(payloadName), err)
+	}
+	return r, nil
+}
+
+// readPayload 读取整个差异文件
+func readPayload(ctx context.Context, source Source, payloadName string) ([]byte, error) {
+	r, err := openPayload(ctx, source, payloadName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(util.NewContextReader(ctx, r))
+}
+
+// PatchFile 把整个旧文件和差异文件读入内存，用 codecName 对应的差异算法生成新文件
+func PatchFile(ctx context.Context, newFilePath, oldFilePath string, source Source, payloadName string, codecName string) error {
+	codec, err := delta.Get(codecName)
+	if err != nil {
+		return &Error{Kind: ErrInvalidManifest, Err: err}
+	}
+	oldBytes, err := ioutil.ReadFile(oldFilePath)
+	if err != nil {
+		return fmt.Errorf(i18n.T("读取旧文件失败：%w"), err)
+	}
+	diffBytes, err := readPayload(ctx, source, payloadName)
+	if err != nil {
+		return fmt.Errorf(i18n.T("读取差异文件失败：%w"), err)
+	}
+	newBytes, err := codec.Patch(oldBytes, diffBytes)
+	if err != nil {
+		return &Error{Kind: ErrCorruptDelta, Path: source.Location(payloadName), Err: err}
+	}
+	if err := ioutil.WriteFile(newFilePath, newBytes, 0644); err != nil {
+		return fmt.Errorf(i18n.T("写入新文件失败：%w"), err)
+	}
+	return nil
+}
+
+// PatchFrom 把旧文件读入内存作为字典解压差异文件，边解压边写入新文件
+func PatchFrom(ctx context.Context, newFilePath, oldFilePath string, source Source, payloadName string) (err error) {
+	oldBytes, err := ioutil.ReadFile(oldFilePath)
+	if err != nil {
+		return err
+	}
+	diffFileReader, err := openPayload(ctx, source, payloadName)
+	if err != nil {
+		return err
+	}
+	defer diffFileReader.Close()
+	newFile, err := os.OpenFile(newFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer newFile.Close()
+	defer util.RemoveOnError(newFilePath, &err)
+	reader := &trackingReader{r: diffFileReader}
+	writer := &trackingWriter{w: util.NewContextWriter(ctx, newFile)}
+	if err := delta.ZstdPatchFromPatch(oldBytes, reader, writer); err != nil {
+		return decodeError(reader, writer, source.Location(payloadName), err)
+	}
+	return newFile.Close()
+}
+
+func CreateSymlink(newDirAbsPath, linkName, target string, symlinkPolicy SymlinkPolicy) error {
+	if util.SymlinkEscapesRoot(newDirAbsPath, linkName, target) {
+		switch symlinkPolicy {
+		case SymlinkPolicySkip:
+			log.Println(i18n.T("跳过指向文件夹之外的符号链接"), linkName, "->", target)
+			return nil
+		case SymlinkPolicyError:
+			return fmt.Errorf(i18n.T("符号链接指向文件夹之外：%s -> %s"), linkName, target)
+		}
+	}
+	linkPath := filepath.Join(newDirAbsPath, linkName)
+	if err := mkdir(filepath.Dir(linkPath)); err != nil {
+		return err
+	}
+	if fileInfo, err := os.Lstat(linkPath); err == nil {
+		if fileInfo.IsDir() {
+			return fmt.Errorf(i18n.T("%s 路径已存在，但不是符号链接"), linkPath)
+		}
+		if err := os.Remove(linkPath); err != nil {
+			return fmt.Errorf(i18n.T("%s 删除已存在的文件失败：%w"), linkPath, err)
+		}
+	}
+	if err := os.Symlink(target, linkPath); err != nil {
+		return fmt.Errorf(i18n.T("%s 创建符号链接失败：%w"), linkName, err)
+	}
+	log.Println(linkName, i18n.T("创建符号链接成功"))
+	return nil
+}
+
+// RemoveDirs 删除新版文件夹中已经不存在于新版的空文件夹，子文件夹先于父文件夹删除，非空的文件夹会保留
+func RemoveDirs(newDirAbsPath string, dirNames []string) error {
+	sortedDirNames := append([]string(nil), dirNames...)
+	sort.Sort(sort.Reverse(sort.StringSlice(sortedDirNames)))
+	for _, dirName := range sortedDirNames {
+		dirPath := filepath.Join(newDirAbsPath, dirName)
+		fileInfo, err := os.Lstat(dirPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf(i18n.T("%s 读取文件夹信息失败：%w"), dirPath, err)
+		} else if !fileInfo.IsDir() {
+			continue
+		}
+		entries, err := ioutil.ReadDir(dirPath)
+		if err != nil {
+			return fmt.Errorf(i18n.T("%s 读取文件夹失败：%w"), dirPath, err)
+		}
+		if len(entries) > 0 {
+			log.Println(dirName, i18n.T("文件夹不为空，保留"))
+			continue
+		}
+		if err := os.Remove(dirPath); err != nil {
+			return fmt.Errorf(i18n.T("%s 删除文件夹失败：%w"), dirPath, err)
+		}
+		log.Println(dirName, i18n.T("删除文件夹成功"))
+	}
+	return nil
+}
+
+// ReadPart 读取旧文件的一块，最后一块可能不足 bulkSize
+func ReadPart(oldFileReader io.Reader, bulkSize int) ([]byte, error) {
+	buf := make([]byte, bulkSize)
+	n, err := io.ReadFull(oldFileReader, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func PartCopyOld(newFileWriter io.Writer, oldFileReader io.Reader, bulkSize int) error {
+	buf, err := ReadPart(oldFileReader, bulkSize)
+	if err != nil {
+		return err
+	}
+	_, err = newFileWriter.Write(buf)
+	return err
+}
+
+// PartCopyNew 复制新文件数据，compression 不为空时边读取边解压
+func PartCopyNew(ctx context.Context, newFileWriter io.Writer, source Source, payloadName string, compression string) error {
+	var compressor delta.Compressor
+	if compression != "" {
+		var err error
+		compressor, err = delta.GetCompressor(compression)
+		if err != nil {
+			return &Error{Kind: ErrInvalidManifest, Err: err}
+		}
+	}
+	diffNewFileReader, err := openPayload(ctx, source, payloadName)
+	if err != nil {
+		return err
+	}
+	defer diffNewFileReader.Close()
+	buf := make([]byte, util.CopyBufferSize)
+	if compressor == nil {
+		_, err = io.CopyBuffer(newFileWriter, util.NewContextReader(ctx, diffNewFileReader), buf)
+		return err
+	}
+	reader := &trackingReader{r: diffNewFileReader}
+	writer := &trackingWriter{w: util.NewContextWriter(ctx, newFileWriter)}
+	decompressReader, err := compressor.NewReader(reader)
+	if err != nil {
+		return decodeError(reader, writer, source.Location(payloadName), err)
+	}
+	defer decompressReader.Close()
+	if _, err := io.CopyBuffer(writer, decompressReader, buf); err != nil {
+		return decodeError(reader, writer, source.Location(payloadName), err)
+	}
+	return nil
+}
+
+func PartPatch(ctx context.Context, newFileWriter io.Writer, oldFileReader io.Reader, source Source, payloadName string, bulkSize int, codec delta.Codec) error {
+	oldFileBytes, err := ReadPart(oldFileReader, bulkSize)
+	if err != nil {
+		return err
+	}
+	diffBytes, err := readPayload(ctx, source, payloadName)
+	if err != nil {
+		return err
+	}
+	newBytes, err := codec.Patch(oldFileBytes, diffBytes)
+	if err != nil {
+		return &Error{Kind: ErrCorruptDelta, Path: source.Location(payloadName), Err: err}
+	}
+	_, err = newFileWriter.Write(newBytes)
+	return err
+}
+
+// CreateZeroFile 生成 size 字节全部为 0 的新文件，文件系统支持时整个文件是一个空洞
+func CreateZeroFile(newFilePath string, size int64) error {
+	newFile, err := os.OpenFile(newFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer newFile.Close()
+	if err := newFile.Truncate(size); err != nil {
+		return err
+	}
+	return newFile.Close()
+}
+
+// CopyNew 用差异文件夹中的新文件数据生成新文件，compression 不为空时边读取边解压
+func CopyNew(ctx context.Context, newFilePath string, source Source, payloadName string, compression string) (err error) {
+	newFileWriter, err := os.OpenFile(newFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer newFileWriter.Close()
+	defer util.RemoveOnError(newFilePath, &err)
+	err = PartCopyNew(ctx, newFileWriter, source, payloadName, compression)
+	if err != nil {
+		return err
+	}
+	return newFileWriter.Close()
+}
+
+// AutoPartPatch 按各块的操作依次生成新文件的每一块，每块开始前检查 ctx，出错或取消时删除写了一半的新文件
+//
+// zero 块不写入数据，只移动写入位置留出空洞，最后一块是 zero 时用 Truncate 扩展文件
+func AutoPartPatch(ctx context.Context, manifest *Manifest, newFilePath, oldFilePath string, source Source, fileName string, partOperations []PartOperation) (err error) {
+	bulkSize := manifest.FileBulkSize(fileName)
+	newFileWriter, err := os.OpenFile(newFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf(i18n.T("打开新文件失败：%w"), err)
+	}
+	defer newFileWriter.Close()
+	defer util.RemoveOnError(newFilePath, &err)
+	oldFileReader, err := os.Open(oldFilePath)
+	if err != nil {
+		return fmt.Errorf(i18n.T("打开旧文件失败：%w"), err)
+	}
+	defer oldFileReader.Close()
+
+	for i, partOperation := range partOperations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		partIndex := i + 1
+		switch partOperation.Type {
+		case OperationTypeCopyOld:
+			if err := PartCopyOld(newFileWriter, oldFileReader, bulkSize); err != nil {
+				return fmt.Errorf(i18n.T("第 %d 块复制旧文件失败：%w"), partIndex, err)
+			}
+		case OperationTypeCopyNew:
+			if _, err := oldFileReader.Seek(int64(bulkSize), io.SeekCurrent); err != nil {
+				return fmt.Errorf(i18n.T("第 %d 块跳过旧文件失败：%w"), partIndex, err)
+			}
+			payloadName := manifest.PayloadName(fileName, partIndex, partOperation)
+			if err := PartCopyNew(ctx, newFileWriter, source, payloadName, partOperation.Argument); err != nil {
+				return fmt.Errorf(i18n.T("第 %d 块复制新文件失败：%w"), partIndex, err)
+			}
+		case OperationTypePatch:
+			codec, err := delta.Get(partOperation.Codec())
+			if err != nil {
+				return fmt.Errorf(i18n.T("第 %d 块更新失败：%w"), partIndex, &Error{Kind: ErrInvalidManifest, Err: err})
+			}
+			payloadName := manifest.PayloadName(fileName, partIndex, partOperation)
+			if err := PartPatch(ctx, newFileWriter, oldFileReader, source, payloadName, bulkSize, codec); err != nil {
+				return fmt.Errorf(i18n.T("第 %d 块更新失败：%w"), partIndex, err)
+			}
+		case OperationTypeZero:
+			size, err := partOperation.ZeroSize()
+			if err != nil {
+				return fmt.Errorf(i18n.T("第 %d 块更新失败：%w"), partIndex, &Error{Kind: ErrInvalidManifest, Err: err})
+			}
+			if _, err := oldFileReader.Seek(int64(bulkSize), io.SeekCurrent); err != nil {
+				return fmt.Errorf(i18n.T("第 %d 块跳过旧文件失败：%w"), partIndex, err)
+			}
+			if err := util.WriteZero(newFileWriter, size); err != nil {
+				return fmt.Errorf(i18n.T("第 %d 块写入空洞失败：%w"), partIndex, err)
+			}
+		default:
+			return &Error{Kind: ErrInvalidManifest, Err: fmt.Errorf(i18n.T("第 %d 块未知操作 %s"), partIndex, partOperation)}
+		}
+	}
+	if err := util.TruncateAtOffset(newFileWriter); err != nil {
+		return fmt.Errorf(i18n.T("写入新文件失败：%w"), err)
+	}
+	return newFileWriter.Close()
+}
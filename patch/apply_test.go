@@ -0,0 +1,223 @@
+package patch_test
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/ganlvtech/go-dir-bsdiff/diff"
+	"github.com/ganlvtech/go-dir-bsdiff/internal/testutil"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func TestCheckDirs(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		oldDir, newDir string
+		ok             bool
+	}{
+		{"old", "new", true},
+		{"old", "old-new", true},
+		{"old", "old", false},
+		{"old", "old/", false},
+		{"old", "old/new", false},
+		{"new/old", "new", false},
+	}
+	for _, test := range tests {
+		err := patch.CheckDirs(filepath.Join(root, test.oldDir), filepath.Join(root, test.newDir))
+		if (err == nil) != test.ok {
+			t.Errorf("CheckDirs(%s, %s) = %v", test.oldDir, test.newDir, err)
+		}
+	}
+	if err := patch.Apply(context.Background(), root, filepath.Join(root, "new"), t.TempDir(), nil); err == nil {
+		t.Error("新版文件夹在旧版文件夹中时应该返回错误")
+	}
+}
+
+// 新版文件夹中已经存在的文件是旧版文件的硬链接时，先删除再写入，不修改旧版文件
+func TestApplyReplacesHardlink(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := testutil.RandomBytes(rng, 100000)
+	edited := append([]byte(nil), base...)
+	copy(edited[5000:], "edited")
+
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	diffDir := filepath.Join(root, "diff")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"a.bin": base})
+	testutil.WriteFiles(t, newDir, map[string][]byte{"a.bin": edited})
+	generate(t, oldDir, newDir, diffDir, 1<<20)
+
+	patchedDir := filepath.Join(root, "patched")
+	if err := os.Mkdir(patchedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(oldDir, "a.bin"), filepath.Join(patchedDir, "a.bin")); err != nil {
+		t.Skip(err)
+	}
+	if err := patch.Apply(context.Background(), oldDir, patchedDir, diffDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertSameDir(t, newDir, patchedDir)
+	got, err := os.ReadFile(filepath.Join(oldDir, "a.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, base) {
+		t.Error("旧版文件被修改")
+	}
+}
+
+// 指向文件夹之外的符号链接在生成和应用补丁时按策略原样记录、跳过或报错，指向文件夹之内的总是保留
+func TestSymlinkPolicies(t *testing.T) {
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"a.txt": []byte("a")})
+	testutil.WriteFiles(t, newDir, map[string][]byte{"a.txt": []byte("a"), "sub/b.txt": []byte("b")})
+	inside := map[string]string{"inside": "a.txt", "sub/up": "../a.txt"}
+	outside := map[string]string{"outside": "../old/a.txt", "sub/absolute": filepath.Join(oldDir, "a.txt")}
+	for _, links := range []map[string]string{inside, outside} {
+		for linkName, target := range links {
+			if err := os.Symlink(target, filepath.Join(newDir, filepath.FromSlash(linkName))); err != nil {
+				t.Skip(err)
+			}
+		}
+	}
+	generateWithPolicy := func(diffDir string, policy patch.SymlinkPolicy) error {
+		options, err := diff.NewOptions("bsdiff", "zstd", 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scans := testutil.ScanDirs(t, oldDir, newDir)
+		return diff.Generate(context.Background(), options, oldDir, newDir, diffDir, scans[0], scans[1], 1<<20, policy, nil)
+	}
+	assertSymlinks := func(dirAbsPath string, want map[string]string) {
+		t.Helper()
+		scans := testutil.ScanDirs(t, dirAbsPath)
+		if !reflect.DeepEqual(scans[0].Symlinks, want) {
+			t.Errorf("符号链接为 %v，期望 %v", scans[0].Symlinks, want)
+		}
+	}
+	all := maps.Clone(inside)
+	maps.Copy(all, outside)
+
+	diffDir := filepath.Join(root, "diff")
+	if err := generateWithPolicy(diffDir, patch.SymlinkPolicyAllow); err != nil {
+		t.Fatal(err)
+	}
+	for policy, want := range map[patch.SymlinkPolicy]map[string]string{patch.SymlinkPolicyAllow: all, patch.SymlinkPolicySkip: inside} {
+		patchedDir := filepath.Join(root, "patched-"+string(policy))
+		if err := patch.Apply(context.Background(), oldDir, patchedDir, diffDir, &patch.ApplyOptions{SymlinkPolicy: policy}); err != nil {
+			t.Fatal(err)
+		}
+		assertSymlinks(patchedDir, want)
+	}
+	if err := patch.Apply(context.Background(), oldDir, filepath.Join(root, "patched-error"), diffDir, &patch.ApplyOptions{SymlinkPolicy: patch.SymlinkPolicyError}); err == nil {
+		t.Error("应用补丁时 error 策略应该返回错误")
+	}
+
+	skipDiffDir := filepath.Join(root, "diff-skip")
+	if err := generateWithPolicy(skipDiffDir, patch.SymlinkPolicySkip); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := patch.ReadManifest(skipDiffDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(manifest.Symlinks, inside) {
+		t.Errorf("skip 策略生成的补丁中符号链接为 %v，期望 %v", manifest.Symlinks, inside)
+	}
+	if err := generateWithPolicy(filepath.Join(root, "diff-error"), patch.SymlinkPolicyError); err == nil {
+		t.Error("生成补丁时 error 策略应该返回错误")
+	}
+}
+
+// copy 操作按 CopyMode 创建硬链接、reflink 或复制，文件系统不支持 reflink 时复制，内容都与旧版文件相同
+func TestCopyOld(t *testing.T) {
+	dir := t.TempDir()
+	oldFilePath := filepath.Join(dir, "old.bin")
+	content := testutil.RandomBytes(rand.New(rand.NewSource(1)), 100000)
+	if err := os.WriteFile(oldFilePath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldInfo, err := os.Stat(oldFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		copyMode patch.CopyMode
+		used     []patch.CopyMode
+	}{
+		{patch.CopyModeCopy, []patch.CopyMode{patch.CopyModeCopy}},
+		{"", []patch.CopyMode{patch.CopyModeCopy}},
+		{patch.CopyModeHardlink, []patch.CopyMode{patch.CopyModeHardlink}},
+		{patch.CopyModeReflink, []patch.CopyMode{patch.CopyModeReflink, patch.CopyModeCopy}},
+	}
+	for _, test := range tests {
+		newFilePath := filepath.Join(dir, "new-"+string(test.copyMode)+".bin")
+		used, err := patch.CopyOld(context.Background(), newFilePath, oldFilePath, test.copyMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(test.used, used) {
+			t.Errorf("%q 实际使用 %q，期望 %v", test.copyMode, used, test.used)
+		}
+		got, err := os.ReadFile(newFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%q 生成的文件内容不一致", test.copyMode)
+		}
+		newInfo, err := os.Stat(newFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os.SameFile(oldInfo, newInfo) != (used == patch.CopyModeHardlink) {
+			t.Errorf("%q 生成的文件是否为旧版文件的硬链接：%v", test.copyMode, os.SameFile(oldInfo, newInfo))
+		}
+	}
+}
+
+// 使用硬链接应用补丁时，未修改的文件是旧版文件的硬链接，修改过的文件重新写入
+func TestApplyCopyModeHardlink(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := testutil.RandomBytes(rng, 100000)
+	edited := append([]byte(nil), base...)
+	copy(edited[5000:], "edited")
+
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	diffDir := filepath.Join(root, "diff")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"a.bin": base, "same.txt": []byte("same")})
+	testutil.WriteFiles(t, newDir, map[string][]byte{"a.bin": edited, "same.txt": []byte("same")})
+	generate(t, oldDir, newDir, diffDir, 1<<20)
+
+	patchedDir := filepath.Join(root, "patched")
+	if err := patch.Apply(context.Background(), oldDir, patchedDir, diffDir, &patch.ApplyOptions{CopyMode: patch.CopyModeHardlink}); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertSameDir(t, newDir, patchedDir)
+	for name, want := range map[string]bool{"same.txt": true, "a.bin": false} {
+		oldInfo, err := os.Stat(filepath.Join(oldDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		newInfo, err := os.Stat(filepath.Join(patchedDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os.SameFile(oldInfo, newInfo) != want {
+			t.Errorf("%s 是否为旧版文件的硬链接：%v，期望 %v", name, !want, want)
+		}
+	}
+}
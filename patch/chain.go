@@ -0,0 +1,97 @@
+package patch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// CheckChain 检查依次应用的补丁是否首尾相接：每个补丁需要的旧版文件都必须由上一个补丁生成，且 MD5 相同
+func CheckChain(manifests []*Manifest) error {
+	for i := 1; i < len(manifests); i++ {
+		prevTreeMd5 := manifests[i-1].NewTreeMd5()
+		for fileName, fileMD5 := range manifests[i].OldMd5 {
+			prevFileMD5, ok := prevTreeMd5[fileName]
+			if !ok {
+				return &Error{Kind: ErrChainMismatch, Err: fmt.Errorf(i18n.T("第 %d 个补丁需要的旧版文件 %s 不在第 %d 个补丁生成的文件中"), i+1, fileName, i)}
+			}
+			if prevFileMD5 != fileMD5 {
+				return &Error{Kind: ErrChainMismatch, Err: fmt.Errorf(i18n.T("第 %d 个补丁需要的旧版文件 %s 的 md5 与第 %d 个补丁生成的不一致"), i+1, fileName, i)}
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyChain 依次应用多个补丁，把旧版文件夹更新到最后一个补丁的新版文件夹
+//
+// 应用前先读取全部补丁描述文件并用 CheckChain 检查。中间版本写入新版文件夹所在目录下的临时文件夹，
+// 下一个补丁应用完成后立即删除，同时最多只存在一个中间版本。ctx 取消或出错时也会删除临时文件夹。
+func ApplyChain(ctx context.Context, oldDirAbsPath, newDirAbsPath string, diffDirAbsPaths []string, options *ApplyOptions) error {
+	sources := make([]Source, len(diffDirAbsPaths))
+	for i, diffDirAbsPath := range diffDirAbsPaths {
+		sources[i] = DirSource(diffDirAbsPath)
+	}
+	return ApplyChainSources(ctx, oldDirAbsPath, newDirAbsPath, sources, options)
+}
+
+// ApplyChainSources 与 ApplyChain 相同，补丁从 sources 读取
+func ApplyChainSources(ctx context.Context, oldDirAbsPath, newDirAbsPath string, sources []Source, options *ApplyOptions) error {
+	if len(sources) == 0 {
+		return errors.New(i18n.T("没有指定补丁"))
+	}
+	if err := CheckDirs(oldDirAbsPath, newDirAbsPath); err != nil {
+		return err
+	}
+	manifests := make([]*Manifest, len(sources))
+	for i, source := range sources {
+		manifest, err := ReadSourceManifest(ctx, source)
+		if err != nil {
+			return fmt.Errorf(i18n.T("读取第 %d 个补丁描述文件错误：%w"), i+1, err)
+		}
+		manifests[i] = manifest
+	}
+	if err := CheckChain(manifests); err != nil {
+		return err
+	}
+
+	stageDirAbsPath := ""
+	defer func() {
+		if stageDirAbsPath != "" {
+			os.RemoveAll(stageDirAbsPath)
+		}
+	}()
+	srcDirAbsPath := oldDirAbsPath
+	for i, manifest := range manifests {
+		dstDirAbsPath := newDirAbsPath
+		if i < len(manifests)-1 {
+			var err error
+			dstDirAbsPath, err = ioutil.TempDir(filepath.Dir(newDirAbsPath), ".bsdiff-chain-")
+			if err != nil {
+				return fmt.Errorf(i18n.T("创建临时文件夹错误：%w"), err)
+			}
+		}
+		log.Printf(i18n.T("正在应用第 %d 个补丁：%s"), i+1, sources[i].Location(""))
+		err := ApplyManifest(ctx, manifest, srcDirAbsPath, dstDirAbsPath, sources[i], options)
+		if stageDirAbsPath != "" {
+			if err := os.RemoveAll(stageDirAbsPath); err != nil {
+				return fmt.Errorf(i18n.T("删除临时文件夹错误：%w"), err)
+			}
+		}
+		stageDirAbsPath = ""
+		if dstDirAbsPath != newDirAbsPath {
+			stageDirAbsPath = dstDirAbsPath
+		}
+		if err != nil {
+			return fmt.Errorf(i18n.T("应用第 %d 个补丁错误：%w"), i+1, err)
+		}
+		srcDirAbsPath = dstDirAbsPath
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package patch_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ganlvtech/go-dir-bsdiff/internal/testutil"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+// chainVersions 生成 v1、v2、v3 三个版本和 v1→v2、v2→v3 两个补丁，返回版本文件夹和差异文件夹
+func chainVersions(t *testing.T, root string) (versions []string, diffDirs []string) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	v1 := testutil.RandomBytes(rng, 100000)
+	v2 := append([]byte(nil), v1...)
+	copy(v2[1000:], "v2")
+	v3 := append([]byte(nil), v2...)
+	copy(v3[50000:], "v3")
+	contents := []map[string][]byte{
+		{"a.bin": v1, "removed.txt": []byte("removed")},
+		{"a.bin": v2, "b.txt": []byte("b")},
+		{"a.bin": v3, "b.txt": []byte("b"), "c.txt": []byte("c")},
+	}
+	for i, files := range contents {
+		versions = append(versions, filepath.Join(root, "v"+strconv.Itoa(i+1)))
+		testutil.WriteFiles(t, versions[i], files)
+	}
+	for i := 1; i < len(versions); i++ {
+		diffDirs = append(diffDirs, filepath.Join(root, "d"+strconv.Itoa(i)+strconv.Itoa(i+1)))
+		generate(t, versions[i-1], versions[i], diffDirs[i-1], 1<<20)
+	}
+	return versions, diffDirs
+}
+
+// assertNoStageDirs 检查中间版本的临时文件夹都已删除
+func assertNoStageDirs(t *testing.T, dirAbsPath string) {
+	t.Helper()
+	stages, err := filepath.Glob(filepath.Join(dirAbsPath, ".bsdiff-chain-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) > 0 {
+		t.Errorf("临时文件夹没有删除：%v", stages)
+	}
+}
+
+func TestApplyChain(t *testing.T) {
+	root := t.TempDir()
+	versions, diffDirs := chainVersions(t, root)
+	outDir := filepath.Join(t.TempDir(), "out")
+	if err := patch.ApplyChain(context.Background(), versions[0], outDir, diffDirs, nil); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertSameDir(t, versions[2], outDir)
+	assertNoStageDirs(t, filepath.Dir(outDir))
+}
+
+// 补丁顺序错误时应用前返回 ErrChainMismatch，中间的补丁出错时删除临时文件夹
+func TestApplyChainErrors(t *testing.T) {
+	root := t.TempDir()
+	versions, diffDirs := chainVersions(t, root)
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	err := patch.ApplyChain(context.Background(), versions[0], outDir, []string{diffDirs[1], diffDirs[0]}, nil)
+	if !errors.Is(err, patch.ErrChainMismatch) {
+		t.Fatalf("补丁顺序错误时返回 %v，期望 ErrChainMismatch", err)
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Error("检查失败后不应该创建新版文件夹")
+	}
+
+	manifest, err := patch.ReadManifest(diffDirs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fileName, operation := range manifest.Patches {
+		for i, partOperation := range patch.ParseOperation(operation) {
+			if payload := manifest.PayloadFileName(diffDirs[1], fileName, i, partOperation); payload != "" {
+				os.Remove(payload)
+			}
+		}
+	}
+	err = patch.ApplyChain(context.Background(), versions[0], outDir, diffDirs, nil)
+	if !errors.Is(err, patch.ErrPayloadMissing) {
+		t.Fatalf("第 2 个补丁缺少差异文件时返回 %v，期望 ErrPayloadMissing", err)
+	}
+	assertNoStageDirs(t, filepath.Dir(outDir))
+}
@@ -0,0 +1,98 @@
+package patch
+
+import (
+	"io"
+	"os"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// 错误类别，可以用 errors.Is 判断
+var (
+	// ErrOldHashMismatch 表示旧版文件不存在或 MD5 与补丁描述文件不一致，旧版文件夹不能应用这个补丁
+	ErrOldHashMismatch = i18n.Error("旧版文件 md5 不正确")
+	// ErrNewHashMismatch 表示应用补丁后新版文件的 MD5 与补丁描述文件不一致
+	ErrNewHashMismatch = i18n.Error("新版文件 md5 不正确")
+	// ErrPayloadMissing 表示补丁描述文件中的差异文件不存在
+	ErrPayloadMissing = i18n.Error("差异文件不存在")
+	// ErrCorruptDelta 表示差异文件无法解码
+	ErrCorruptDelta = i18n.Error("差异文件已损坏")
+	// ErrInvalidManifest 表示补丁描述文件不存在、格式错误或包含未知的操作
+	ErrInvalidManifest = i18n.Error("补丁描述文件无效")
+	// ErrChainMismatch 表示多个补丁不能按顺序连续应用
+	ErrChainMismatch = i18n.Error("补丁不能连续应用")
+)
+
+// Error 是带有类别的错误，Kind 是上面的错误类别之一，Path 是相关的文件路径，Err 是具体原因
+//
+// errors.Is 可以同时判断类别和原因，如 os.ErrNotExist
+type Error struct {
+	Kind error
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	message := e.Kind.Error()
+	if e.Path != "" {
+		message = e.Path + " " + message
+	}
+	if e.Err != nil {
+		message += i18n.T("：") + e.Err.Error()
+	}
+	return message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// payloadError 归类打开或读取差异文件的错误，差异文件不存在时返回 ErrPayloadMissing
+func payloadError(payloadPath string, err error) error {
+	if os.IsNotExist(err) {
+		return &Error{Kind: ErrPayloadMissing, Path: payloadPath, Err: err}
+	}
+	return err
+}
+
+// trackingWriter 记录写入新文件时的错误，用于区分写入失败（如磁盘已满）和差异文件损坏
+type trackingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// trackingReader 记录读取差异文件时的错误，用于区分读取失败（如网络中断）和差异文件损坏
+type trackingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *trackingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// decodeError 归类解码差异文件的错误，读取差异文件和写入新文件的错误原样返回，其他错误为 ErrCorruptDelta
+func decodeError(r *trackingReader, w *trackingWriter, payloadPath string, err error) error {
+	if w.err != nil {
+		return w.err
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return &Error{Kind: ErrCorruptDelta, Path: payloadPath, Err: err}
+}
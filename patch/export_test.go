@@ -0,0 +1,4 @@
+package patch
+
+// NewServerWithRescanInterval 与 NewServer 相同，可以指定查找新补丁的最短间隔
+var NewServerWithRescanInterval = newServer
@@ -0,0 +1,233 @@
+package patch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+const (
+	// DefaultHTTPRetries 是 HTTP 请求失败或读取中断后默认的重试次数
+	DefaultHTTPRetries = 3
+	// DefaultHTTPRetryDelay 是第一次重试前默认的等待时间，之后每次加倍
+	DefaultHTTPRetryDelay = time.Second
+)
+
+// HTTPSource 从 HTTP 服务器读取差异文件夹，只请求补丁描述文件和应用补丁时需要的差异文件
+//
+// 请求失败或读取中断时等待一段时间后重试，已经读取过的数据不再重新下载，而是用 Range 请求从中断的位置继续读取
+type HTTPSource struct {
+	// BaseURL 是差异文件夹的地址，以 / 结尾
+	BaseURL *url.URL
+	// Client 为 nil 时使用 http.DefaultClient
+	Client *http.Client
+	// Retries 是每个文件请求失败或读取中断后的重试次数
+	Retries int
+	// RetryDelay 是第一次重试前的等待时间，之后每次加倍
+	RetryDelay time.Duration
+}
+
+// NewHTTPSource 返回差异文件夹地址为 baseURL 的 HTTPSource，baseURL 末尾没有 / 时自动补上
+func NewHTTPSource(baseURL string) (*HTTPSource, error) {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("差异文件夹地址 %s 无效：%w"), baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf(i18n.T("差异文件夹地址 %s 无效：只支持 http 和 https"), baseURL)
+	}
+	return &HTTPSource{
+		BaseURL:    u,
+		Retries:    DefaultHTTPRetries,
+		RetryDelay: DefaultHTTPRetryDelay,
+	}, nil
+}
+
+// IsHTTPURL 判断路径是否是 HTTP 地址
+func IsHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func (s *HTTPSource) Location(name string) string {
+	return s.BaseURL.ResolveReference(&url.URL{Path: name}).String()
+}
+
+func (s *HTTPSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	r := &httpReader{ctx: ctx, source: s, url: s.Location(name), size: -1}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *HTTPSource) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// httpReader 读取一个文件，读取中断时从已经读取的位置重新请求
+type httpReader struct {
+	ctx    context.Context
+	source *HTTPSource
+	url    string
+	body   io.ReadCloser
+	// offset 是已经读取的字节数
+	offset int64
+	// size 是文件大小，服务器没有返回时为 -1
+	size int64
+	// etag 用于 If-Range，文件在两次请求之间被修改时服务器返回整个新文件，不能继续读取
+	etag string
+	// retried 是已经重试的次数
+	retried int
+}
+
+// httpStatusError 是服务器返回的错误状态码，5xx 可以重试
+type httpStatusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf(i18n.T("请求 %s 错误：%s"), e.url, e.status)
+}
+
+// connect 从 offset 开始请求文件，失败时按 Retries 重试
+func (r *httpReader) connect() error {
+	for {
+		err := r.request()
+		if err == nil {
+			return nil
+		}
+		if err := r.wait(err); err != nil {
+			return err
+		}
+	}
+}
+
+// wait 判断 err 能否重试，可以重试时等待后返回 nil，否则返回 err
+func (r *httpReader) wait(err error) error {
+	if r.ctx.Err() != nil {
+		return r.ctx.Err()
+	}
+	if statusErr, ok := err.(*httpStatusError); ok && statusErr.code < 500 {
+		return err
+	}
+	if os.IsNotExist(err) || r.retried >= r.source.Retries {
+		return err
+	}
+	delay := r.source.RetryDelay << uint(r.retried)
+	r.retried++
+	log.Printf(i18n.T("%s 读取错误，%s 后第 %d 次重试：%v"), r.url, delay, r.retried, err)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+func (r *httpReader) request() error {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		if r.etag != "" {
+			req.Header.Set("If-Range", r.etag)
+		}
+	}
+	resp, err := r.source.client().Do(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		resp.Body.Close()
+		return &os.PathError{Op: "GET", Path: r.url, Err: os.ErrNotExist}
+	case resp.StatusCode == http.StatusOK:
+		if r.offset > 0 && (r.etag == "" || resp.Header.Get("ETag") != r.etag) {
+			resp.Body.Close()
+			return fmt.Errorf(i18n.T("%s 在读取过程中被修改或服务器不支持 Range 请求，无法继续读取"), r.url)
+		}
+		if r.offset > 0 {
+			// 服务器忽略了 Range，跳过已经读取的部分
+			if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+				resp.Body.Close()
+				return err
+			}
+		}
+		if resp.ContentLength >= 0 {
+			r.size = resp.ContentLength
+		}
+	case resp.StatusCode == http.StatusPartialContent && r.offset > 0:
+		var start, end, size int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil || start != r.offset {
+			resp.Body.Close()
+			return fmt.Errorf(i18n.T("%s 返回的 Content-Range 无效：%s"), r.url, resp.Header.Get("Content-Range"))
+		}
+		r.size = size
+	default:
+		resp.Body.Close()
+		return &httpStatusError{url: r.url, status: resp.Status, code: resp.StatusCode}
+	}
+	if r.offset == 0 {
+		r.etag = resp.Header.Get("ETag")
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *httpReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if err := r.connect(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF && (r.size < 0 || r.offset >= r.size) {
+			return n, io.EOF
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return n, nil
+		}
+		r.body.Close()
+		r.body = nil
+		if err := r.wait(err); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *httpReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
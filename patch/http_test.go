@@ -0,0 +1,245 @@
+package patch_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ganlvtech/go-dir-bsdiff/diff"
+	"github.com/ganlvtech/go-dir-bsdiff/internal/testutil"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
+
+// generate 用默认选项生成补丁，与 diff 子命令相同
+func generate(t *testing.T, oldDirAbsPath, newDirAbsPath, diffDirAbsPath string, bulkSize int) *patch.Manifest {
+	t.Helper()
+	options, err := diff.NewOptions("bsdiff", "zstd", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scans := testutil.ScanDirs(t, oldDirAbsPath, newDirAbsPath)
+	if err := diff.Generate(context.Background(), options, oldDirAbsPath, newDirAbsPath, diffDirAbsPath, scans[0], scans[1], bulkSize, patch.SymlinkPolicyAllow, nil); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := patch.ReadManifest(diffDirAbsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+// httpTestServer 记录每次请求的 Range 和 If-Range，handler 的参数 n 是第几次请求，从 0 开始
+type httpTestServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	ranges   []string
+	ifRanges []string
+}
+
+func newHTTPTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, n int)) *httpTestServer {
+	t.Helper()
+	s := &httpTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		n := len(s.ranges)
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.ifRanges = append(s.ifRanges, r.Header.Get("If-Range"))
+		s.mu.Unlock()
+		handler(w, r, n)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *httpTestServer) source(t *testing.T) *patch.HTTPSource {
+	t.Helper()
+	source, err := patch.NewHTTPSource(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.RetryDelay = time.Millisecond
+	return source
+}
+
+// cutOff 声明完整的长度，只写入 content 的前一半后断开连接
+func cutOff(w http.ResponseWriter, content []byte) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content[:len(content)/2])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func readAll(t *testing.T, source patch.Source, name string) ([]byte, error) {
+	t.Helper()
+	r, err := source.Open(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// 读取中断后用 Range 和 If-Range 从中断的位置继续读取
+func TestHTTPSourceResume(t *testing.T) {
+	content := testutil.RandomBytes(rand.New(rand.NewSource(1)), 1<<20)
+	modTime := time.Unix(1700000000, 0)
+	s := newHTTPTestServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set("ETag", `"v1"`)
+		if n == 0 {
+			cutOff(w, content)
+			return
+		}
+		http.ServeContent(w, r, "a.bin", modTime, bytes.NewReader(content))
+	})
+
+	got, err := readAll(t, s.source(t), "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("读取 %d 字节，与原文件不一致", len(got))
+	}
+	if len(s.ranges) != 2 {
+		t.Fatalf("请求 %d 次，期望 2 次", len(s.ranges))
+	}
+	if s.ranges[0] != "" {
+		t.Errorf("第 1 次请求的 Range 为 %q", s.ranges[0])
+	}
+	if want := "bytes=" + strconv.Itoa(len(content)/2) + "-"; s.ranges[1] != want {
+		t.Errorf("第 2 次请求的 Range 为 %q，期望 %q", s.ranges[1], want)
+	}
+	if s.ifRanges[1] != `"v1"` {
+		t.Errorf("第 2 次请求的 If-Range 为 %q", s.ifRanges[1])
+	}
+}
+
+// 服务器忽略 Range 时，ETag 相同则跳过已经读取的部分，没有 ETag 时无法确认文件没有被修改，返回错误
+func TestHTTPSourceIgnoreRange(t *testing.T) {
+	content := testutil.RandomBytes(rand.New(rand.NewSource(1)), 1<<20)
+	for _, etag := range []string{`"v1"`, ""} {
+		t.Run("ETag="+etag, func(t *testing.T) {
+			s := newHTTPTestServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+				if etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+				if n == 0 {
+					cutOff(w, content)
+					return
+				}
+				w.Write(content)
+			})
+			got, err := readAll(t, s.source(t), "a.bin")
+			if etag == "" {
+				if err == nil {
+					t.Fatal("没有 ETag 时应该返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("读取 %d 字节，与原文件不一致", len(got))
+			}
+		})
+	}
+}
+
+// 5xx 错误重试，重试次数用完后返回错误，4xx 错误不重试
+func TestHTTPSourceRetry(t *testing.T) {
+	content := []byte("content")
+	s := newHTTPTestServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/flaky") && n%2 == 0:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case strings.HasSuffix(r.URL.Path, "/broken"):
+			http.Error(w, "error", http.StatusInternalServerError)
+		case strings.HasSuffix(r.URL.Path, "/forbidden"):
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			w.Write(content)
+		}
+	})
+	source := s.source(t)
+
+	got, err := readAll(t, source, "flaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("读取内容为 %q", got)
+	}
+	if len(s.ranges) != 2 {
+		t.Errorf("请求 %d 次，期望 2 次", len(s.ranges))
+	}
+
+	s.ranges = nil
+	if _, err := readAll(t, source, "broken"); err == nil {
+		t.Error("重试次数用完后应该返回错误")
+	}
+	if len(s.ranges) != source.Retries+1 {
+		t.Errorf("请求 %d 次，期望 %d 次", len(s.ranges), source.Retries+1)
+	}
+
+	s.ranges = nil
+	if _, err := readAll(t, source, "forbidden"); err == nil {
+		t.Error("403 应该返回错误")
+	}
+	if len(s.ranges) != 1 {
+		t.Errorf("请求 %d 次，期望 1 次", len(s.ranges))
+	}
+}
+
+// 从 HTTP 服务器应用补丁，差异文件返回 404 时错误为 ErrPayloadMissing
+func TestHTTPSourceApply(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := testutil.RandomBytes(rng, 100000)
+	edited := append([]byte(nil), base...)
+	copy(edited[5000:], "edited")
+
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	diffDir := filepath.Join(root, "diff")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"a.bin": base})
+	testutil.WriteFiles(t, newDir, map[string][]byte{"a.bin": edited, "b.bin": testutil.RandomBytes(rng, 1000)})
+	manifest := generate(t, oldDir, newDir, diffDir, 1<<20)
+
+	missing := ""
+	fileServer := http.FileServer(http.Dir(diffDir))
+	s := newHTTPTestServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		if missing != "" && strings.HasSuffix(r.URL.Path, "/"+missing) {
+			http.NotFound(w, r)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+
+	patchedDir := filepath.Join(root, "patched")
+	if err := patch.ApplySource(context.Background(), s.source(t), oldDir, patchedDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	testutil.AssertSameDir(t, newDir, patchedDir)
+
+	partOperations := patch.ParseOperation(manifest.Patches["a.bin"])
+	missing = filepath.Base(manifest.PayloadFileName(diffDir, "a.bin", 0, partOperations[0]))
+	err := patch.ApplySource(context.Background(), s.source(t), oldDir, filepath.Join(root, "missing"), nil)
+	if !errors.Is(err, patch.ErrPayloadMissing) {
+		t.Fatalf("返回 %v，期望 ErrPayloadMissing", err)
+	}
+}
@@ -0,0 +1,147 @@
+package patch
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// PartInfo 是文件一块的操作和差异文件大小
+type PartInfo struct {
+	Index       int    `json:"index"`
+	Operation   string `json:"operation"`
+	PayloadSize int64  `json:"payload_size"`
+}
+
+// FileInfo 是一个文件的操作统计，NewSize 为 -1 表示补丁描述文件中没有记录新版文件大小
+type FileInfo struct {
+	Name        string     `json:"name"`
+	Operation   string     `json:"operation"`
+	NewSize     int64      `json:"new_size"`
+	PayloadSize int64      `json:"payload_size"`
+	Ratio       float64    `json:"ratio,omitempty"`
+	Parts       []PartInfo `json:"parts,omitempty"`
+	// BulkSize 是分块文件的分块大小，为 0 表示与补丁的分块大小相同
+	BulkSize int `json:"bulk_size,omitempty"`
+}
+
+// OperationTotal 是一种操作的合计，Count 是使用这种操作的文件或块的数量
+type OperationTotal struct {
+	Operation   string `json:"operation"`
+	Count       int    `json:"count"`
+	PayloadSize int64  `json:"payload_size"`
+}
+
+// Info 是一个补丁的统计信息
+type Info struct {
+	ManifestVersion string           `json:"manifest_version"`
+	BulkSize        int              `json:"bulk_size"`
+	OldHash         string           `json:"old_hash,omitempty"`
+	NewHash         string           `json:"new_hash,omitempty"`
+	Files           []FileInfo       `json:"files"`
+	Totals          []OperationTotal `json:"totals"`
+	Symlinks        int              `json:"symlinks"`
+	Dirs            int              `json:"dirs"`
+	RemovedDirs     int              `json:"removed_dirs"`
+	NewSize         int64            `json:"new_size"`
+	PayloadSize     int64            `json:"payload_size"`
+	Ratio           float64          `json:"ratio,omitempty"`
+}
+
+func ratio(payloadSize, newSize int64) float64 {
+	if newSize <= 0 {
+		return 0
+	}
+	return float64(payloadSize) / float64(newSize)
+}
+
+// Inspect 统计补丁中每个文件的操作、各块的操作和差异文件大小，以及每种操作的合计
+//
+// 压缩比例是差异文件大小除以新版文件大小，补丁描述文件中没有记录新版文件大小时不计算。
+func Inspect(manifest *Manifest, diffDirAbsPath string) (*Info, error) {
+	info := &Info{
+		ManifestVersion: manifest.ManifestVersion,
+		BulkSize:        manifest.BulkSize,
+		OldHash:         manifest.OldHash,
+		NewHash:         manifest.NewHash,
+		Files:           make([]FileInfo, 0, len(manifest.Patches)),
+		Symlinks:        len(manifest.Symlinks),
+		Dirs:            len(manifest.Dirs),
+		RemovedDirs:     len(manifest.RemovedDirs),
+	}
+	totals := make(map[string]*OperationTotal)
+	addTotal := func(partOperation PartOperation, payloadSize int64) {
+		// zero 操作的参数是字节数，合计时不区分
+		operation := partOperation.String()
+		if partOperation.Type == OperationTypeZero {
+			operation = OperationTypeZero
+		}
+		total, ok := totals[operation]
+		if !ok {
+			total = &OperationTotal{Operation: operation}
+			totals[operation] = total
+		}
+		total.Count++
+		total.PayloadSize += payloadSize
+	}
+	payloadSize := func(fileName string, partIndex int, partOperation PartOperation) (int64, error) {
+		payloadPath := manifest.PayloadFileName(diffDirAbsPath, fileName, partIndex, partOperation)
+		if payloadPath == "" {
+			return 0, nil
+		}
+		fileInfo, err := os.Stat(payloadPath)
+		if err != nil {
+			return 0, fmt.Errorf(i18n.T("%s 读取差异文件信息错误：%w"), fileName, err)
+		}
+		return fileInfo.Size(), nil
+	}
+
+	knownNewSize := int64(0)
+	knownPayloadSize := int64(0)
+	for fileName, operation := range manifest.Patches {
+		fileInfo := FileInfo{Name: fileName, Operation: operation, NewSize: -1, BulkSize: manifest.BulkSizes[fileName]}
+		if newSize, ok := manifest.NewSize[fileName]; ok {
+			fileInfo.NewSize = newSize
+		}
+		partOperations := ParseOperation(operation)
+		if len(partOperations) == 1 {
+			size, err := payloadSize(fileName, 0, partOperations[0])
+			if err != nil {
+				return nil, err
+			}
+			fileInfo.PayloadSize = size
+			addTotal(partOperations[0], size)
+		} else {
+			for i, partOperation := range partOperations {
+				size, err := payloadSize(fileName, i+1, partOperation)
+				if err != nil {
+					return nil, err
+				}
+				fileInfo.Parts = append(fileInfo.Parts, PartInfo{Index: i + 1, Operation: partOperation.String(), PayloadSize: size})
+				fileInfo.PayloadSize += size
+				addTotal(partOperation, size)
+			}
+		}
+		if fileInfo.NewSize >= 0 {
+			fileInfo.Ratio = ratio(fileInfo.PayloadSize, fileInfo.NewSize)
+			knownNewSize += fileInfo.NewSize
+			knownPayloadSize += fileInfo.PayloadSize
+			info.NewSize += fileInfo.NewSize
+		}
+		info.PayloadSize += fileInfo.PayloadSize
+		info.Files = append(info.Files, fileInfo)
+	}
+	info.Ratio = ratio(knownPayloadSize, knownNewSize)
+	sort.Slice(info.Files, func(i, j int) bool {
+		return info.Files[i].Name < info.Files[j].Name
+	})
+	for _, total := range totals {
+		info.Totals = append(info.Totals, *total)
+	}
+	sort.Slice(info.Totals, func(i, j int) bool {
+		return info.Totals[i].Operation < info.Totals[j].Operation
+	})
+	return info, nil
+}
@@ -0,0 +1,84 @@
+package patch_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ganlvtech/go-dir-bsdiff/internal/testutil"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func TestInspect(t *testing.T) {
+	const bulkSize = 64 << 10
+	rng := rand.New(rand.NewSource(1))
+	base := testutil.RandomBytes(rng, 3*bulkSize)
+	edited := append([]byte(nil), base...)
+	copy(edited[bulkSize+500:], "edited")
+
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	diffDir := filepath.Join(root, "diff")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"chunked.bin": base, "same.txt": []byte("same")})
+	testutil.WriteFiles(t, newDir, map[string][]byte{
+		"chunked.bin": edited,
+		"same.txt":    []byte("same"),
+		"added.bin":   testutil.RandomBytes(rng, 1000),
+		"zero.bin":    make([]byte, 4096),
+	})
+	manifest := generate(t, oldDir, newDir, diffDir, bulkSize)
+
+	info, err := patch.Inspect(manifest, diffDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"added.bin", "chunked.bin", "same.txt", "zero.bin"}
+	if len(info.Files) != len(names) {
+		t.Fatalf("%d 个文件，期望 %d 个", len(info.Files), len(names))
+	}
+	totalCount := 0
+	for _, total := range info.Totals {
+		totalCount += total.Count
+	}
+	var newSize, payloadSize int64
+	for i, file := range info.Files {
+		if file.Name != names[i] {
+			t.Errorf("第 %d 个文件为 %s，期望 %s", i+1, file.Name, names[i])
+		}
+		if file.Operation != manifest.Patches[file.Name] || file.NewSize != manifest.NewSize[file.Name] {
+			t.Errorf("%s 的操作为 %s，新版大小 %d", file.Name, file.Operation, file.NewSize)
+		}
+		newSize += file.NewSize
+		payloadSize += file.PayloadSize
+	}
+	if chunked := info.Files[1]; len(chunked.Parts) != 3 || chunked.Parts[0].Operation != patch.OperationTypeCopyOld || chunked.Parts[1].PayloadSize == 0 {
+		t.Errorf("chunked.bin 的分块为 %+v", chunked.Parts)
+	}
+	if same := info.Files[2]; same.PayloadSize != 0 || same.Parts != nil {
+		t.Errorf("same.txt 为 %+v", same)
+	}
+	if totalCount != 6 {
+		t.Errorf("操作合计 %d 个，期望 3 个文件和 3 个分块", totalCount)
+	}
+	if info.NewSize != newSize || info.PayloadSize != payloadSize || info.Ratio != float64(payloadSize)/float64(newSize) {
+		t.Errorf("合计新版大小 %d，差异文件大小 %d，比例 %v", info.NewSize, info.PayloadSize, info.Ratio)
+	}
+
+	addedPayload := manifest.PayloadFileName(diffDir, "added.bin", 0, patch.ParseOperation(manifest.Patches["added.bin"])[0])
+	addedInfo, err := os.Stat(addedPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Files[0].PayloadSize != addedInfo.Size() {
+		t.Errorf("added.bin 的差异文件大小为 %d，期望 %d", info.Files[0].PayloadSize, addedInfo.Size())
+	}
+
+	if err := os.Remove(addedPayload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := patch.Inspect(manifest, diffDir); err == nil {
+		t.Error("缺少差异文件时应该返回错误")
+	}
+}
@@ -1,24 +1,171 @@
 package patch
 
-import "fmt"
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
 
 const (
-	BsDiffFileSuffix = ".bsdiff"
-	ManifestFileName = "patch.json"
+	BsDiffFileSuffix    = ".bsdiff"
+	PatchFromFileSuffix = ".zstdpatch"
+	ManifestFileName    = "patch.json"
 )
 
 const (
 	OperationTypeCopyOld = "copy"
 	OperationTypeCopyNew = "new"
 	OperationTypePatch   = "patch"
+	// OperationTypePatchFrom 以旧文件为字典用 zstd 分段压缩新文件，只用于未分块的文件
+	OperationTypePatchFrom = "patch-from"
+	// OperationTypeZero 表示新文件或新文件的这一块全部为 0，参数是字节数，没有差异文件，应用补丁时写为空洞
+	OperationTypeZero = "zero"
+)
+
+const (
+	// PartOperationSeparator 分隔文件各块的操作
+	PartOperationSeparator = ","
+	// OperationArgumentSeparator 分隔操作类型和参数，如 patch:vcdiff
+	OperationArgumentSeparator = ":"
+	// DefaultPatchCodec 是没有记录差异算法的 patch 操作使用的算法
+	DefaultPatchCodec = "bsdiff"
+)
+
+// PartOperation 是一个文件或一个文件块的操作，对 patch 操作来说 Argument 是差异算法名称，
+// 对 new 操作来说 Argument 是压缩算法名称，为空表示未压缩，对 zero 操作来说 Argument 是字节数
+type PartOperation struct {
+	Type     string
+	Argument string
+}
+
+func (o PartOperation) String() string {
+	if o.Argument == "" {
+		return o.Type
+	}
+	return o.Type + OperationArgumentSeparator + o.Argument
+}
+
+// Codec 返回 patch 操作使用的差异算法名称
+func (o PartOperation) Codec() string {
+	if o.Argument == "" {
+		return DefaultPatchCodec
+	}
+	return o.Argument
+}
+
+// ZeroSize 返回 zero 操作的字节数
+func (o PartOperation) ZeroSize() (int64, error) {
+	size, err := strconv.ParseInt(o.Argument, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf(i18n.T("zero 操作的字节数无效：%s"), o.Argument)
+	}
+	return size, nil
+}
+
+// ZeroOperation 返回 size 字节全部为 0 的操作
+func ZeroOperation(size int64) PartOperation {
+	return PartOperation{Type: OperationTypeZero, Argument: strconv.FormatInt(size, 10)}
+}
+
+func ParsePartOperation(operation string) PartOperation {
+	parts := strings.SplitN(operation, OperationArgumentSeparator, 2)
+	if len(parts) == 1 {
+		return PartOperation{Type: parts[0]}
+	}
+	return PartOperation{Type: parts[0], Argument: parts[1]}
+}
+
+// ParseOperation 解析补丁描述文件中一个文件的操作，未分块的文件只有一个操作
+func ParseOperation(operation string) []PartOperation {
+	partOperations := make([]PartOperation, 0)
+	for _, partOperation := range strings.Split(operation, PartOperationSeparator) {
+		partOperations = append(partOperations, ParsePartOperation(partOperation))
+	}
+	return partOperations
+}
+
+// UsesOldFile 判断操作是否需要旧文件，分块的文件即使全部是 new 或 zero 也需要打开旧文件
+func UsesOldFile(partOperations []PartOperation) bool {
+	if len(partOperations) > 1 {
+		return true
+	}
+	return partOperations[0].Type != OperationTypeCopyNew && partOperations[0].Type != OperationTypeZero
+}
+
+// SymlinkPolicy 决定如何处理指向文件夹之外的符号链接
+type SymlinkPolicy string
+
+const (
+	// SymlinkPolicyAllow 原样记录和创建
+	SymlinkPolicyAllow SymlinkPolicy = "allow"
+	// SymlinkPolicySkip 跳过该符号链接
+	SymlinkPolicySkip SymlinkPolicy = "skip"
+	// SymlinkPolicyError 报错退出
+	SymlinkPolicyError SymlinkPolicy = "error"
+)
+
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch policy := SymlinkPolicy(s); policy {
+	case SymlinkPolicyAllow, SymlinkPolicySkip, SymlinkPolicyError:
+		return policy, nil
+	default:
+		return "", fmt.Errorf(i18n.T("未知的符号链接策略：%s"), s)
+	}
+}
+
+// CopyMode 决定应用补丁时如何生成 copy 操作的新版文件
+type CopyMode string
+
+const (
+	// CopyModeCopy 复制旧版文件的全部内容
+	CopyModeCopy CopyMode = "copy"
+	// CopyModeHardlink 创建指向旧版文件的硬链接，修改其中一个会同时修改另一个，失败时（如不在同一个文件系统中）复制
+	CopyModeHardlink CopyMode = "hardlink"
+	// CopyModeReflink 创建与旧版文件共享数据块的文件（Linux 上 btrfs、xfs 等文件系统的 FICLONE），失败时复制
+	CopyModeReflink CopyMode = "reflink"
 )
 
+func ParseCopyMode(s string) (CopyMode, error) {
+	switch mode := CopyMode(s); mode {
+	case CopyModeCopy, CopyModeHardlink, CopyModeReflink:
+		return mode, nil
+	default:
+		return "", fmt.Errorf(i18n.T("未知的复制方式：%s"), s)
+	}
+}
+
 type Manifest struct {
 	ManifestVersion string            `json:"manifest_version"`
 	BulkSize        int               `json:"bulk_size"`
 	OldMd5          map[string]string `json:"old_md5"`
 	NewMd5          map[string]string `json:"new_md5"`
 	Patches         map[string]string `json:"patches"`
+	Symlinks        map[string]string `json:"symlinks,omitempty"`
+	Dirs            []string          `json:"dirs,omitempty"`
+	RemovedDirs     []string          `json:"removed_dirs,omitempty"`
+	// NewSize 是新版文件的大小，用于统计，旧版本的补丁描述文件中没有
+	NewSize map[string]int64 `json:"new_size,omitempty"`
+	// PayloadStore 是多个补丁共用的差异文件存储相对于补丁描述文件所在文件夹的路径，使用 / 分隔
+	PayloadStore string `json:"payload_store,omitempty"`
+	// Payloads 是差异文件相对路径到存储中文件名的映射，不在其中的差异文件位于补丁描述文件所在文件夹
+	Payloads map[string]string `json:"payloads,omitempty"`
+	// OldHash 和 NewHash 是旧版和新版文件夹的版本哈希，见 util.TreeMD5，旧版本的补丁描述文件中没有
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+	// BulkSizes 是分块大小与 BulkSize 不同的文件的分块大小，旧版本的补丁描述文件中没有
+	BulkSizes map[string]int `json:"bulk_sizes,omitempty"`
+}
+
+// FileBulkSize 返回文件的分块大小，BulkSizes 中没有时为 BulkSize
+func (m *Manifest) FileBulkSize(fileName string) int {
+	if bulkSize, ok := m.BulkSizes[fileName]; ok {
+		return bulkSize
+	}
+	return m.BulkSize
 }
 
 func NewPatchManifest(bulkSize int) *Manifest {
@@ -28,13 +175,81 @@ func NewPatchManifest(bulkSize int) *Manifest {
 		OldMd5:          nil,
 		NewMd5:          nil,
 		Patches:         nil,
+		Symlinks:        nil,
+		Dirs:            nil,
+		RemovedDirs:     nil,
+		NewSize:         nil,
+		PayloadStore:    "",
+		Payloads:        nil,
+		OldHash:         "",
+		NewHash:         "",
 	}
 }
 
+// GetNewFileName 返回新文件数据路径，压缩后的文件后缀名为压缩算法名称
+func GetNewFileName(basePath string, compression string) string {
+	if compression == "" {
+		return basePath
+	}
+	return basePath + "." + compression
+}
+
 func GetPartNewFileName(basePath string, partIndex int) string {
 	return fmt.Sprintf("%s.part.%d", basePath, partIndex)
 }
 
-func GetPartDiffFileName(basePath string, partIndex int) string {
-	return fmt.Sprintf("%s.part.%d", basePath, partIndex) + BsDiffFileSuffix
+// GetDiffFileName 返回差异文件路径，后缀名为差异算法名称，bsdiff 的后缀名即为 BsDiffFileSuffix
+func GetDiffFileName(basePath string, codec string) string {
+	return basePath + "." + codec
+}
+
+func GetPatchFromFileName(basePath string) string {
+	return basePath + PatchFromFileSuffix
+}
+
+func GetPartDiffFileName(basePath string, partIndex int, codec string) string {
+	return GetDiffFileName(GetPartNewFileName(basePath, partIndex), codec)
+}
+
+// GetPayloadFileName 返回操作在差异文件夹中对应的文件路径，partIndex 为 0 表示未分块的文件，copy 操作没有对应的文件，返回空字符串
+func GetPayloadFileName(basePath string, partIndex int, operation PartOperation) string {
+	if partIndex > 0 {
+		basePath = GetPartNewFileName(basePath, partIndex)
+	}
+	switch operation.Type {
+	case OperationTypeCopyNew:
+		return GetNewFileName(basePath, operation.Argument)
+	case OperationTypePatch:
+		return GetDiffFileName(basePath, operation.Codec())
+	case OperationTypePatchFrom:
+		return GetPatchFromFileName(basePath)
+	}
+	return ""
+}
+
+// PayloadName 返回文件 fileName 第 partIndex 块的操作对应的差异文件相对差异文件夹的路径，使用 / 分隔，
+// partIndex 为 0 表示未分块的文件，差异文件保存在共用存储中时返回存储中的路径，copy 操作返回空字符串
+func (m *Manifest) PayloadName(fileName string, partIndex int, operation PartOperation) string {
+	payloadKey := GetPayloadKey(fileName, partIndex, operation)
+	if payloadKey == "" || m.Payloads == nil {
+		return payloadKey
+	}
+	if object, ok := m.Payloads[payloadKey]; ok {
+		return path.Join(m.PayloadStore, object)
+	}
+	return payloadKey
+}
+
+// PayloadFileName 与 PayloadName 相同，返回的是差异文件夹 diffDirAbsPath 中的文件路径
+func (m *Manifest) PayloadFileName(diffDirAbsPath, fileName string, partIndex int, operation PartOperation) string {
+	payloadName := m.PayloadName(fileName, partIndex, operation)
+	if payloadName == "" {
+		return ""
+	}
+	return DirSource(diffDirAbsPath).Location(payloadName)
+}
+
+// GetPayloadKey 返回差异文件在 Payloads 中的键，即使用 / 分隔的相对路径
+func GetPayloadKey(fileName string, partIndex int, operation PartOperation) string {
+	return filepath.ToSlash(GetPayloadFileName(fileName, partIndex, operation))
 }
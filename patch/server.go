@@ -0,0 +1,277 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// LatestPath 是服务器查询更新方案的地址
+const LatestPath = "/latest"
+
+// ErrUnknownVersion 表示索引中没有从这个版本开始的补丁
+var ErrUnknownVersion = i18n.Error("没有从这个版本开始的补丁")
+
+// PatchIndex 是一个文件夹中全部补丁的索引，按补丁描述文件中的版本哈希把补丁连接起来
+type PatchIndex struct {
+	// Patches 是差异文件夹相对根文件夹的路径（使用 / 分隔，根文件夹为 .）到补丁描述文件的映射
+	Patches map[string]*Manifest
+	// Latest 是最新版本的版本哈希
+	Latest string
+}
+
+// UpdatePlan 是从一个版本更新到最新版本需要依次应用的补丁
+type UpdatePlan struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Patches 是差异文件夹相对根文件夹的地址，以 / 结尾，已经是最新版本时为空
+	Patches []string `json:"patches"`
+}
+
+// IndexPatches 查找 rootDirAbsPath 中全部补丁描述文件，无效或者没有版本哈希的补丁会被跳过
+//
+// latest 为空时，最新版本是唯一一个不是任何补丁的旧版的新版，有多个或者没有（如同时提供了反向补丁）时返回错误
+func IndexPatches(rootDirAbsPath string, latest string) (*PatchIndex, error) {
+	index := &PatchIndex{Patches: make(map[string]*Manifest), Latest: latest}
+	err := filepath.Walk(rootDirAbsPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != ManifestFileName {
+			return nil
+		}
+		diffDirAbsPath := filepath.Dir(filePath)
+		manifest, err := ReadManifest(diffDirAbsPath)
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+		if manifest.OldHash == "" || manifest.NewHash == "" {
+			log.Println(filePath, i18n.T("没有版本哈希，跳过"))
+			return nil
+		}
+		relPath, err := filepath.Rel(rootDirAbsPath, diffDirAbsPath)
+		if err != nil {
+			return err
+		}
+		index.Patches[filepath.ToSlash(relPath)] = manifest
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("查找补丁错误：%w"), err)
+	}
+	if index.Latest != "" {
+		return index, nil
+	}
+	oldHashes := make(map[string]bool)
+	for _, manifest := range index.Patches {
+		oldHashes[manifest.OldHash] = true
+	}
+	candidates := make(map[string]bool)
+	for _, manifest := range index.Patches {
+		if !oldHashes[manifest.NewHash] {
+			candidates[manifest.NewHash] = true
+		}
+	}
+	if len(candidates) != 1 {
+		return nil, fmt.Errorf(i18n.T("无法确定最新版本，有 %d 个候选版本，需要指定最新版本"), len(candidates))
+	}
+	for hash := range candidates {
+		index.Latest = hash
+	}
+	return index, nil
+}
+
+// Plan 返回从版本 from 更新到最新版本需要的补丁，补丁数量最少，数量相同时按差异文件夹路径排序选择
+func (index *PatchIndex) Plan(from string) (*UpdatePlan, error) {
+	plan := &UpdatePlan{From: from, To: index.Latest, Patches: []string{}}
+	if from == index.Latest {
+		return plan, nil
+	}
+	diffDirs := make([]string, 0, len(index.Patches))
+	for diffDir := range index.Patches {
+		diffDirs = append(diffDirs, diffDir)
+	}
+	sort.Strings(diffDirs)
+
+	// 从 from 开始广度优先搜索，prev 记录到达每个版本的补丁
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 && prev[index.Latest] == "" {
+		hash := queue[0]
+		queue = queue[1:]
+		for _, diffDir := range diffDirs {
+			manifest := index.Patches[diffDir]
+			if manifest.OldHash != hash {
+				continue
+			}
+			if _, ok := prev[manifest.NewHash]; ok {
+				continue
+			}
+			prev[manifest.NewHash] = diffDir
+			queue = append(queue, manifest.NewHash)
+		}
+	}
+	if prev[index.Latest] == "" {
+		return nil, &Error{Kind: ErrUnknownVersion, Path: from}
+	}
+	for hash := index.Latest; hash != from; {
+		diffDir := prev[hash]
+		plan.Patches = append([]string{diffDir + "/"}, plan.Patches...)
+		hash = index.Patches[diffDir].OldHash
+	}
+	return plan, nil
+}
+
+// manifestStamp 是补丁描述文件的修改时间和大小，用于判断索引是否需要重新建立
+type manifestStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// indexRescanInterval 是服务器遍历根文件夹查找新补丁的最短间隔
+const indexRescanInterval = 10 * time.Second
+
+// patchIndexCache 缓存 IndexPatches 的结果，补丁描述文件被添加、删除或修改时重新建立索引
+type patchIndexCache struct {
+	rootDirAbsPath string
+	latest         string
+	rescanInterval time.Duration
+	mu             sync.Mutex
+	stamps         map[string]manifestStamp
+	scannedAt      time.Time
+	index          *PatchIndex
+}
+
+// walkManifests 遍历根文件夹，返回全部补丁描述文件的路径到修改时间和大小的映射
+func (c *patchIndexCache) walkManifests() (map[string]manifestStamp, error) {
+	stamps := make(map[string]manifestStamp)
+	err := filepath.Walk(c.rootDirAbsPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && info.Name() == ManifestFileName {
+			stamps[filePath] = manifestStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T("查找补丁错误：%w"), err)
+	}
+	return stamps, nil
+}
+
+// statManifests 只检查上次遍历时找到的补丁描述文件，无法读取的文件不在结果中
+func (c *patchIndexCache) statManifests() map[string]manifestStamp {
+	stamps := make(map[string]manifestStamp, len(c.stamps))
+	for filePath := range c.stamps {
+		if info, err := os.Stat(filePath); err == nil {
+			stamps[filePath] = manifestStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// get 返回索引。每次查询只检查已知的补丁描述文件，有变化或者距离上次遍历超过 rescanInterval 时才遍历根文件夹，
+// 补丁描述文件都没有变化时使用缓存，不重新读取
+func (c *patchIndexCache) get() (*PatchIndex, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stamps := c.statManifests()
+	if c.index == nil || !maps.Equal(stamps, c.stamps) || time.Since(c.scannedAt) >= c.rescanInterval {
+		var err error
+		stamps, err = c.walkManifests()
+		if err != nil {
+			c.index = nil
+			return nil, err
+		}
+		c.scannedAt = time.Now()
+	}
+	if c.index != nil && maps.Equal(stamps, c.stamps) {
+		return c.index, nil
+	}
+	// 先记录修改时间再读取，读取过程中被修改的补丁描述文件在下次查询时会重新读取
+	index, err := IndexPatches(c.rootDirAbsPath, c.latest)
+	if err != nil {
+		c.index = nil
+		return nil, err
+	}
+	c.stamps = stamps
+	c.index = index
+	return index, nil
+}
+
+// NewServer 返回提供 rootDirAbsPath 中补丁的 http.Handler，latest 为空时自动确定最新版本
+//
+// GET /latest?from=版本哈希 返回 UpdatePlan 的 JSON，其他地址返回根文件夹中的文件，支持 Range 请求。
+// 补丁索引会被缓存，已有的补丁描述文件被删除或修改时立即重新建立，新添加的补丁最多 10 秒后被找到，不需要重启服务器。
+func NewServer(rootDirAbsPath string, latest string) http.Handler {
+	return newServer(rootDirAbsPath, latest, indexRescanInterval)
+}
+
+func newServer(rootDirAbsPath string, latest string, rescanInterval time.Duration) http.Handler {
+	cache := &patchIndexCache{rootDirAbsPath: rootDirAbsPath, latest: latest, rescanInterval: rescanInterval}
+	mux := http.NewServeMux()
+	mux.HandleFunc(LatestPath, func(w http.ResponseWriter, r *http.Request) {
+		from := r.URL.Query().Get("from")
+		if from == "" {
+			http.Error(w, i18n.T("缺少 from 参数"), http.StatusBadRequest)
+			return
+		}
+		index, err := cache.get()
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		plan, err := index.Plan(from)
+		if errors.Is(err, ErrUnknownVersion) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plan)
+	})
+	mux.Handle("/", fileHandler(rootDirAbsPath))
+	return mux
+}
+
+// fileHandler 返回根文件夹中的文件，不列出文件夹内容，ETag 由修改时间和文件大小组成，用于 If-Range
+func fileHandler(rootDirAbsPath string) http.HandlerFunc {
+	root := http.Dir(rootDirAbsPath)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		f, err := root.Open(path.Clean("/" + r.URL.Path))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	}
+}
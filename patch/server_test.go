@@ -0,0 +1,137 @@
+package patch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func writeVersionManifest(t *testing.T, diffDirAbsPath, oldHash, newHash string) {
+	t.Helper()
+	if err := os.MkdirAll(diffDirAbsPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := patch.NewPatchManifest(1 << 20)
+	manifest.OldHash = oldHash
+	manifest.NewHash = newHash
+	if err := patch.WriteManifest(diffDirAbsPath, manifest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serveLatest(server http.Handler, from string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, patch.LatestPath+"?from="+from, nil))
+	return w
+}
+
+func queryLatest(t *testing.T, server http.Handler, from string) *patch.UpdatePlan {
+	t.Helper()
+	w := serveLatest(server, from)
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 %d：%s", w.Code, w.Body.String())
+	}
+	var plan patch.UpdatePlan
+	if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	return &plan
+}
+
+// 补丁索引被缓存，添加、删除或修改补丁描述文件后重新建立
+func TestServerIndexCache(t *testing.T) {
+	root := t.TempDir()
+	writeVersionManifest(t, filepath.Join(root, "d12"), "v1", "v2")
+	server := patch.NewServerWithRescanInterval(root, "", 0)
+
+	plan := queryLatest(t, server, "v1")
+	if plan.To != "v2" || !reflect.DeepEqual(plan.Patches, []string{"d12/"}) {
+		t.Fatalf("更新方案为 %+v", plan)
+	}
+
+	// 添加补丁
+	writeVersionManifest(t, filepath.Join(root, "d23"), "v2", "v3")
+	plan = queryLatest(t, server, "v1")
+	if plan.To != "v3" || !reflect.DeepEqual(plan.Patches, []string{"d12/", "d23/"}) {
+		t.Fatalf("添加补丁后更新方案为 %+v", plan)
+	}
+
+	// 修改补丁，修改时间设为以后，避免文件系统的时间精度不够
+	writeVersionManifest(t, filepath.Join(root, "d23"), "v2", "v4")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "d23", patch.ManifestFileName), future, future); err != nil {
+		t.Fatal(err)
+	}
+	plan = queryLatest(t, server, "v1")
+	if plan.To != "v4" {
+		t.Fatalf("修改补丁后更新方案为 %+v", plan)
+	}
+
+	// 删除补丁
+	if err := os.RemoveAll(filepath.Join(root, "d23")); err != nil {
+		t.Fatal(err)
+	}
+	plan = queryLatest(t, server, "v1")
+	if plan.To != "v2" || !reflect.DeepEqual(plan.Patches, []string{"d12/"}) {
+		t.Fatalf("删除补丁后更新方案为 %+v", plan)
+	}
+}
+
+// 没有到查找新补丁的时间时只检查已知的补丁描述文件，修改和删除立即生效，新添加的补丁不会被找到
+func TestServerIndexRescanInterval(t *testing.T) {
+	root := t.TempDir()
+	writeVersionManifest(t, filepath.Join(root, "d12"), "v1", "v2")
+	writeVersionManifest(t, filepath.Join(root, "d23"), "v2", "v3")
+	server := patch.NewServerWithRescanInterval(root, "", time.Hour)
+	if plan := queryLatest(t, server, "v1"); plan.To != "v3" {
+		t.Fatalf("更新方案为 %+v", plan)
+	}
+
+	writeVersionManifest(t, filepath.Join(root, "d34"), "v3", "v4")
+	if plan := queryLatest(t, server, "v1"); plan.To != "v3" {
+		t.Fatalf("没有到查找新补丁的时间，更新方案为 %+v", plan)
+	}
+
+	// 修改已知的补丁会重新遍历，同时找到新添加的补丁
+	writeVersionManifest(t, filepath.Join(root, "d12"), "v0", "v2")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "d12", patch.ManifestFileName), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if plan := queryLatest(t, server, "v0"); plan.To != "v4" || len(plan.Patches) != 3 {
+		t.Fatalf("修改补丁后更新方案为 %+v", plan)
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "d34")); err != nil {
+		t.Fatal(err)
+	}
+	if plan := queryLatest(t, server, "v0"); plan.To != "v3" {
+		t.Fatalf("删除补丁后更新方案为 %+v", plan)
+	}
+}
+
+// 查询错误时返回对应的状态码，不返回 JSON
+func TestServerLatestErrors(t *testing.T) {
+	root := t.TempDir()
+	writeVersionManifest(t, filepath.Join(root, "d12"), "v1", "v2")
+	server := patch.NewServerWithRescanInterval(root, "", 0)
+	if w := serveLatest(server, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("缺少 from 参数时状态码 %d", w.Code)
+	}
+	if w := serveLatest(server, "v0"); w.Code != http.StatusNotFound {
+		t.Errorf("未知版本时状态码 %d", w.Code)
+	}
+
+	// 反向补丁让最新版本无法确定
+	writeVersionManifest(t, filepath.Join(root, "d21"), "v2", "v1")
+	if w := serveLatest(server, "v1"); w.Code != http.StatusInternalServerError {
+		t.Errorf("无法确定最新版本时状态码 %d：%s", w.Code, w.Body.String())
+	}
+}
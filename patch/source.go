@@ -0,0 +1,27 @@
+package patch
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Source 是读取差异文件夹中文件的来源，如本地文件夹或 HTTP 服务器
+type Source interface {
+	// Open 打开差异文件夹中的文件，name 是使用 / 分隔的相对路径，文件不存在时返回的错误满足 os.IsNotExist
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// Location 返回 name 对应的完整路径或地址，用于日志和错误信息
+	Location(name string) string
+}
+
+// DirSource 是本地的差异文件夹
+type DirSource string
+
+func (d DirSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(d.Location(name))
+}
+
+func (d DirSource) Location(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
@@ -0,0 +1,83 @@
+package patch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+	"github.com/ganlvtech/go-dir-bsdiff/util"
+)
+
+// VerifyResult 是校验文件夹的结果，各列表都是相对路径
+type VerifyResult struct {
+	Checked int
+	// Missing 是不存在的文件、符号链接和文件夹
+	Missing []string
+	// Mismatched 是 MD5 不正确的文件和目标不正确的符号链接
+	Mismatched []string
+}
+
+func (r *VerifyResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0
+}
+
+func (r *VerifyResult) sort() {
+	sort.Strings(r.Missing)
+	sort.Strings(r.Mismatched)
+}
+
+func verifyFiles(dirAbsPath string, filesMD5 map[string]string, result *VerifyResult) error {
+	for fileName, fileMD5 := range filesMD5 {
+		result.Checked++
+		filePath := filepath.Join(dirAbsPath, fileName)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			result.Missing = append(result.Missing, fileName)
+			continue
+		}
+		actualMD5, err := util.FileMD5(filePath)
+		if err != nil {
+			return fmt.Errorf(i18n.T("%s 文件 md5 计算错误：%w"), filePath, err)
+		}
+		if actualMD5 != fileMD5 {
+			result.Mismatched = append(result.Mismatched, fileName)
+		}
+	}
+	return nil
+}
+
+// VerifyOld 检查旧版文件夹能否应用补丁，即补丁需要的旧版文件是否都存在且 MD5 正确
+func VerifyOld(manifest *Manifest, oldDirAbsPath string) (*VerifyResult, error) {
+	result := &VerifyResult{}
+	if err := verifyFiles(oldDirAbsPath, manifest.OldMd5, result); err != nil {
+		return nil, err
+	}
+	result.sort()
+	return result, nil
+}
+
+// VerifyNew 检查新版文件夹是否与补丁生成的结果一致，包括全部文件、符号链接和文件夹，不检查多余的文件
+func VerifyNew(manifest *Manifest, newDirAbsPath string) (*VerifyResult, error) {
+	result := &VerifyResult{}
+	if err := verifyFiles(newDirAbsPath, manifest.NewTreeMd5(), result); err != nil {
+		return nil, err
+	}
+	for linkName, target := range manifest.Symlinks {
+		result.Checked++
+		actualTarget, err := os.Readlink(filepath.Join(newDirAbsPath, linkName))
+		if os.IsNotExist(err) {
+			result.Missing = append(result.Missing, linkName)
+		} else if err != nil || actualTarget != target {
+			result.Mismatched = append(result.Mismatched, linkName)
+		}
+	}
+	for _, dirName := range manifest.Dirs {
+		result.Checked++
+		if fileInfo, err := os.Stat(filepath.Join(newDirAbsPath, dirName)); err != nil || !fileInfo.IsDir() {
+			result.Missing = append(result.Missing, dirName)
+		}
+	}
+	result.sort()
+	return result, nil
+}
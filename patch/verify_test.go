@@ -0,0 +1,66 @@
+package patch_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ganlvtech/go-dir-bsdiff/internal/testutil"
+	"github.com/ganlvtech/go-dir-bsdiff/patch"
+)
+
+func TestVerify(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := testutil.RandomBytes(rng, 100000)
+	edited := append([]byte(nil), base...)
+	copy(edited[5000:], "edited")
+
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	diffDir := filepath.Join(root, "diff")
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"a.bin": base, "same.txt": []byte("same"), "removed.txt": []byte("removed")})
+	testutil.WriteFiles(t, newDir, map[string][]byte{"a.bin": edited, "same.txt": []byte("same"), "added.txt": []byte("added")})
+	if err := os.Mkdir(filepath.Join(newDir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("same.txt", filepath.Join(newDir, "link")); err != nil {
+		t.Skip(err)
+	}
+	manifest := generate(t, oldDir, newDir, diffDir, 1<<20)
+
+	verify := func(verifyDir func(*patch.Manifest, string) (*patch.VerifyResult, error), dirAbsPath string, missing, mismatched []string) {
+		t.Helper()
+		result, err := verifyDir(manifest, dirAbsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.Missing, missing) || !reflect.DeepEqual(result.Mismatched, mismatched) {
+			t.Errorf("缺少 %v，不一致 %v，期望缺少 %v，不一致 %v", result.Missing, result.Mismatched, missing, mismatched)
+		}
+		if result.OK() != (len(missing) == 0 && len(mismatched) == 0) {
+			t.Errorf("OK() 为 %v", result.OK())
+		}
+	}
+
+	// 旧版文件夹只检查补丁需要的文件，被删除的文件不影响
+	verify(patch.VerifyOld, oldDir, nil, nil)
+	verify(patch.VerifyNew, newDir, nil, nil)
+	verify(patch.VerifyNew, oldDir, []string{"added.txt", "empty", "link"}, []string{"a.bin"})
+
+	testutil.WriteFiles(t, oldDir, map[string][]byte{"a.bin": []byte("modified"), "removed.txt": []byte("modified")})
+	if err := os.Remove(filepath.Join(oldDir, "same.txt")); err != nil {
+		t.Fatal(err)
+	}
+	verify(patch.VerifyOld, oldDir, []string{"same.txt"}, []string{"a.bin"})
+
+	if err := os.Remove(filepath.Join(newDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("added.txt", filepath.Join(newDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	verify(patch.VerifyNew, newDir, nil, []string{"link"})
+}
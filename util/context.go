@@ -0,0 +1,48 @@
+package util
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// NewContextReader 返回在 ctx 取消后停止读取的 Reader，用于中断大文件的复制、压缩和解压
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+// RemoveOnError 在 *err 不为 nil 时删除写了一半的文件，配合 defer 使用，避免出错或取消后留下不完整的文件
+func RemoveOnError(path string, err *error) {
+	if *err != nil {
+		os.Remove(path)
+	}
+}
+
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// NewContextWriter 返回在 ctx 取消后停止写入的 Writer，用于中断边解压边写入的操作
+func NewContextWriter(ctx context.Context, w io.Writer) io.Writer {
+	return &contextWriter{ctx: ctx, w: w}
+}
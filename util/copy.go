@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"io"
 	"os"
 )
@@ -13,6 +14,11 @@ const (
 // copy file attributes.
 // https://stackoverflow.com/questions/21060945/simple-way-to-copy-a-file-in-golang/21061062#21061062
 func CopyFile(dst, src string) error {
+	return CopyFileContext(context.Background(), dst, src)
+}
+
+// CopyFileContext 与 CopyFile 相同，ctx 取消后停止复制，出错或取消时删除写了一半的 dst
+func CopyFileContext(ctx context.Context, dst, src string) (err error) {
 	in, err := os.Open(src)
 	if err != nil {
 		return err
@@ -24,15 +30,24 @@ func CopyFile(dst, src string) error {
 		return err
 	}
 	defer out.Close()
+	defer RemoveOnError(dst, &err)
 
 	buf := make([]byte, CopyBufferSize)
-	_, err = io.CopyBuffer(out, in, buf)
+	_, err = io.CopyBuffer(out, NewContextReader(ctx, in), buf)
 	if err != nil {
 		return err
 	}
 	return out.Close()
 }
 
+// LinkFile 创建指向 src 的硬链接 dst，已经存在的 dst 会先被删除
+func LinkFile(dst, src string) error {
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Link(src, dst)
+}
+
 func WriteAll(path string, r io.Reader) (int64, error) {
 	w, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
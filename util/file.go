@@ -3,6 +3,8 @@ package util
 import (
 	"fmt"
 	"os"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
 )
 
 type FileInfoResult int
@@ -52,9 +54,9 @@ func MkdirIfNotExists(path string) (MkdirIfNotExistsResult, error) {
 
 func GetFileSize(path string) (int64, error) {
 	if fileInfo, err := os.Stat(path); os.IsNotExist(err) {
-		return 0, fmt.Errorf("文件不存在：%s", err)
+		return 0, fmt.Errorf(i18n.T("文件不存在：%w"), err)
 	} else if fileInfo.IsDir() {
-		return 0, fmt.Errorf("此路径不是文件：%s", err)
+		return 0, fmt.Errorf(i18n.T("此路径不是文件：%w"), err)
 	} else {
 		return fileInfo.Size(), nil
 	}
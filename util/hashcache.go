@@ -0,0 +1,118 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+type hashCacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Inode   uint64 `json:"inode"`
+	MD5     string `json:"md5"`
+}
+
+// HashCache 是持久化的文件 MD5 缓存，以绝对路径为键
+//
+// 文件大小、修改时间、inode 任一改变时缓存失效，重新计算 MD5。
+// 保存时只保留本次运行中查询过的文件。
+type HashCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]hashCacheEntry
+	used    map[string]hashCacheEntry
+	hits    int
+	misses  int
+}
+
+// LoadHashCache 读取缓存文件，文件不存在时返回空缓存
+func LoadHashCache(path string) (*HashCache, error) {
+	c := &HashCache{
+		path:    path,
+		entries: make(map[string]hashCacheEntry),
+		used:    make(map[string]hashCacheEntry),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf(i18n.T("读取 MD5 缓存文件错误：%w"), err)
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf(i18n.T("MD5 缓存文件格式错误：%w"), err)
+	}
+	return c, nil
+}
+
+// FileMD5 返回文件的 MD5，缓存有效时不读取文件内容，可以在多个协程中同时调用
+func (c *HashCache) FileMD5(path string, info os.FileInfo) (string, error) {
+	entry := hashCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Inode:   fileInode(info),
+	}
+	c.mu.Lock()
+	cached, ok := c.entries[path]
+	if ok && cached.Size == entry.Size && cached.ModTime == entry.ModTime && cached.Inode == entry.Inode {
+		c.used[path] = cached
+		c.hits++
+		c.mu.Unlock()
+		return cached.MD5, nil
+	}
+	c.mu.Unlock()
+
+	md5sum, err := FileMD5(path)
+	if err != nil {
+		return "", err
+	}
+	entry.MD5 = md5sum
+
+	c.mu.Lock()
+	c.entries[path] = entry
+	c.used[path] = entry
+	c.misses++
+	c.mu.Unlock()
+	return md5sum, nil
+}
+
+// Stats 返回缓存命中和未命中的次数
+func (c *HashCache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Save 写入缓存文件，先写临时文件再重命名，避免中断时损坏缓存
+func (c *HashCache) Save() error {
+	c.mu.Lock()
+	data, err := json.Marshal(c.used)
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf(i18n.T("MD5 缓存编码错误：%w"), err)
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf(i18n.T("创建 MD5 缓存临时文件错误：%w"), err)
+	}
+	tmpPath := tmpFile.Name()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf(i18n.T("写入 MD5 缓存文件错误：%w"), err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf(i18n.T("写入 MD5 缓存文件错误：%w"), err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf(i18n.T("写入 MD5 缓存文件错误：%w"), err)
+	}
+	return nil
+}
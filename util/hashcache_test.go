@@ -0,0 +1,99 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func hashCacheFileMD5(t *testing.T, c *HashCache, path string) string {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md5sum, err := c.FileMD5(path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md5sum
+}
+
+// 文件没有变化时使用缓存的 MD5，修改后重新计算，保存时只保留查询过的文件
+func TestHashCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "md5cache.json")
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	for path, content := range map[string]string{a: "aaaa", b: "bbbb"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantA, err := FileMD5(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashCacheFileMD5(t, c, a)
+	hashCacheFileMD5(t, c, b)
+	if hits, misses := c.Stats(); hits != 0 || misses != 2 {
+		t.Fatalf("命中 %d 次，未命中 %d 次", hits, misses)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 缓存中的 MD5 被改掉后仍然返回缓存的值，说明没有重新读取文件
+	c, err = LoadHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := c.entries[a]
+	entry.MD5 = "cached"
+	c.entries[a] = entry
+	if got := hashCacheFileMD5(t, c, a); got != "cached" {
+		t.Errorf("文件没有变化时返回 %q，期望使用缓存", got)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 大小相同、修改时间不同时重新计算
+	if err := os.WriteFile(a, []byte("AAAA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(a, future, future); err != nil {
+		t.Fatal(err)
+	}
+	c, err = LoadHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.entries[b]; ok {
+		t.Error("没有查询过的 b.txt 仍然保存在缓存中")
+	}
+	got := hashCacheFileMD5(t, c, a)
+	if want, _ := FileMD5(a); got != want || got == wantA {
+		t.Errorf("修改后返回 %q，期望 %q", got, want)
+	}
+	if hits, misses := c.Stats(); hits != 0 || misses != 1 {
+		t.Errorf("命中 %d 次，未命中 %d 次", hits, misses)
+	}
+}
+
+func TestLoadHashCacheInvalid(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "md5cache.json")
+	if err := os.WriteFile(cachePath, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHashCache(cachePath); err == nil {
+		t.Error("缓存文件格式错误时应该返回错误")
+	}
+}
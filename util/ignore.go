@@ -0,0 +1,171 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+// IgnoreFileName 是旧版和新版文件夹根目录下会被自动读取的排除规则文件名
+const IgnoreFileName = ".bsdiffignore"
+
+type ignorePattern struct {
+	negate   bool
+	dirOnly  bool
+	segments []string
+}
+
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+	p := ignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+	// 不含 / 的规则匹配任意层级下的同名文件或文件夹
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	p.segments = strings.Split(line, "/")
+	if !anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	return p, true
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// match 判断规则是否匹配该路径或它的任意上级文件夹
+func (p ignorePattern) match(segments []string, isDir bool) bool {
+	for i := 1; i <= len(segments); i++ {
+		if p.dirOnly && i == len(segments) && !isDir {
+			continue
+		}
+		if matchSegments(p.segments, segments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoreRules 是 gitignore 风格的排除和包含规则
+//
+// 排除规则按顺序匹配，后面的规则优先，以 ! 开头的规则表示重新包含。
+// 如果设置了包含规则，则只有匹配包含规则的文件会被扫描，文件夹总是会被遍历，
+// 但只有含有被包含文件的文件夹才会被记录。
+type IgnoreRules struct {
+	excludes []ignorePattern
+	includes []ignorePattern
+}
+
+func NewIgnoreRules() *IgnoreRules {
+	return &IgnoreRules{}
+}
+
+func (r *IgnoreRules) AddExclude(pattern string) {
+	if p, ok := parseIgnorePattern(pattern); ok {
+		r.excludes = append(r.excludes, p)
+	}
+}
+
+func (r *IgnoreRules) AddInclude(pattern string) {
+	if p, ok := parseIgnorePattern(pattern); ok {
+		r.includes = append(r.includes, p)
+	}
+}
+
+// HasIncludes 判断是否设置了包含规则
+func (r *IgnoreRules) HasIncludes() bool {
+	return r != nil && len(r.includes) > 0
+}
+
+// AddExcludeFile 读取 gitignore 格式的排除规则文件
+func (r *IgnoreRules) AddExcludeFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf(i18n.T("打开排除规则文件错误：%w"), err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r.AddExclude(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf(i18n.T("读取排除规则文件错误：%w"), err)
+	}
+	return nil
+}
+
+// AddExcludeFileIfExists 读取文件夹根目录下的 IgnoreFileName 文件，文件不存在时不做任何事
+func (r *IgnoreRules) AddExcludeFileIfExists(dirAbsPath string) error {
+	ignoreFilePath := filepath.Join(dirAbsPath, IgnoreFileName)
+	if fileInfo, err := GetFileInfo(ignoreFilePath); err != nil {
+		return err
+	} else if fileInfo != FileInfoResultExistFile {
+		return nil
+	}
+	return r.AddExcludeFile(ignoreFilePath)
+}
+
+// Excluded 判断相对路径是否应该被排除
+func (r *IgnoreRules) Excluded(relPath string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	excluded := false
+	for _, p := range r.excludes {
+		if p.match(segments, isDir) {
+			excluded = !p.negate
+		}
+	}
+	if excluded {
+		return true
+	}
+	if !isDir && len(r.includes) > 0 {
+		included := false
+		for _, p := range r.includes {
+			if p.match(segments, isDir) {
+				included = !p.negate
+			}
+		}
+		return !included
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnoreRulesExcluded(t *testing.T) {
+	tests := []struct {
+		name     string
+		excludes []string
+		includes []string
+		relPath  string
+		isDir    bool
+		want     bool
+	}{
+		{"无规则", nil, nil, "a/b.txt", false, false},
+		{"不含斜杠匹配任意层级", []string{"*.log"}, nil, "a/b/c.log", false, true},
+		{"不含斜杠不匹配其他扩展名", []string{"*.log"}, nil, "a/b/c.txt", false, false},
+		{"开头斜杠只匹配根目录", []string{"/build"}, nil, "build/a.o", false, true},
+		{"开头斜杠不匹配子目录", []string{"/build"}, nil, "src/build/a.o", false, false},
+		{"含斜杠的规则锚定根目录", []string{"src/*.o"}, nil, "src/a.o", false, true},
+		{"含斜杠的规则不匹配更深层级", []string{"src/*.o"}, nil, "lib/src/a.o", false, false},
+		{"开头双星号匹配任意层级", []string{"**/cache"}, nil, "a/b/cache/x", false, true},
+		{"中间双星号匹配零层", []string{"a/**/b.txt"}, nil, "a/b.txt", false, true},
+		{"中间双星号匹配多层", []string{"a/**/b.txt"}, nil, "a/x/y/b.txt", false, true},
+		{"结尾双星号匹配全部内容", []string{"a/**"}, nil, "a/x/y.txt", false, true},
+		{"斜杠结尾匹配文件夹", []string{"tmp/"}, nil, "tmp", true, true},
+		{"斜杠结尾匹配文件夹中的文件", []string{"tmp/"}, nil, "x/tmp/a.txt", false, true},
+		{"斜杠结尾不匹配同名文件", []string{"tmp/"}, nil, "x/tmp", false, false},
+		{"感叹号重新包含", []string{"*.log", "!keep.log"}, nil, "a/keep.log", false, false},
+		{"后面的规则优先", []string{"!keep.log", "*.log"}, nil, "a/keep.log", false, true},
+		{"反斜杠转义感叹号", []string{"\\!a"}, nil, "!a", false, true},
+		{"注释和空行被忽略", []string{"# *.txt", ""}, nil, "a.txt", false, false},
+		{"包含规则匹配", nil, []string{"*.png"}, "img/a.png", false, false},
+		{"包含规则不匹配", nil, []string{"*.png"}, "img/a.jpg", false, true},
+		{"包含规则不影响文件夹", nil, []string{"*.png"}, "img", true, false},
+		{"包含文件夹中的文件", nil, []string{"assets/"}, "assets/a/b.bin", false, false},
+		{"包含规则中的感叹号", nil, []string{"*.png", "!thumb.png"}, "thumb.png", false, true},
+		{"排除规则优先于包含规则", []string{"tmp/"}, []string{"*.png"}, "tmp/a.png", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewIgnoreRules()
+			for _, p := range tt.excludes {
+				r.AddExclude(p)
+			}
+			for _, p := range tt.includes {
+				r.AddInclude(p)
+			}
+			if got := r.Excluded(filepath.FromSlash(tt.relPath), tt.isDir); got != tt.want {
+				t.Errorf("Excluded(%q, %v) = %v, want %v", tt.relPath, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanDirIncludeSkipsDirsWithoutIncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/b/c.png", "a/d.txt", "e/f.txt", "g/h/i.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := NewIgnoreRules()
+	rules.AddInclude("*.png")
+	result, err := ScanDir(context.Background(), dir, &ScanOptions{Ignore: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDirs := map[string]bool{"a": true, filepath.Join("a", "b"): true}
+	if !reflect.DeepEqual(result.Dirs, wantDirs) {
+		t.Errorf("Dirs = %v, want %v", result.Dirs, wantDirs)
+	}
+	if len(result.Files) != 1 || result.Files[filepath.Join("a", "b", "c.png")] == "" {
+		t.Errorf("Files = %v", result.Files)
+	}
+
+	result, err = ScanDir(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Dirs) != 6 {
+		t.Errorf("没有包含规则时应记录全部文件夹，Dirs = %v", result.Dirs)
+	}
+}
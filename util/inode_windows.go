@@ -0,0 +1,8 @@
+package util
+
+import "os"
+
+// Windows 上 os.FileInfo 不提供文件索引号，只依靠大小和修改时间判断
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -1,13 +1,16 @@
 package util
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
 )
 
 func BytesMD5(data []byte) string {
@@ -19,13 +22,14 @@ func BytesMD5(data []byte) string {
 func FileMD5(path string) (string, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("计算文件 MD5 时打开文件错误：%s", err)
+		return "", fmt.Errorf(i18n.T("计算文件 MD5 时打开文件错误：%w"), err)
 	}
 	defer f.Close()
 
 	md5hash := md5.New()
-	if _, err := io.Copy(md5hash, f); err != nil {
-		return "", fmt.Errorf("计算文件 MD5 时读取文件错误：%s", err)
+	buf := make([]byte, CopyBufferSize)
+	if _, err := io.CopyBuffer(md5hash, f, buf); err != nil {
+		return "", fmt.Errorf(i18n.T("计算文件 MD5 时读取文件错误：%w"), err)
 	}
 
 	md5sum := md5hash.Sum(nil)
@@ -33,28 +37,29 @@ func FileMD5(path string) (string, error) {
 	return result, nil
 }
 
+// DirFilesMD5 计算文件夹中全部普通文件的 MD5，符号链接不会被跟随
 func DirFilesMD5(dirAbsPath string) (map[string]string, error) {
-	md5List := make(map[string]string)
-	filePathPrefix := dirAbsPath + "\\"
-	err := filepath.Walk(dirAbsPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			if !strings.HasPrefix(path, filePathPrefix) {
-				return fmt.Errorf("路径 %s 不以 %s 为前缀", path, filePathPrefix)
-			}
-			relPath := path[len(filePathPrefix):]
-			md5sum, err := FileMD5(path)
-			if err != nil {
-				return err
-			}
-			md5List[relPath] = md5sum
-		}
-		return nil
-	})
+	result, err := ScanDir(context.Background(), dirAbsPath, nil)
 	if err != nil {
-		return nil, fmt.Errorf("遍历目录全部文件错误：%s", err)
+		return nil, err
+	}
+	return result.Files, nil
+}
+
+// TreeMD5 计算文件夹的版本哈希，即按相对路径排序后全部文件的相对路径（使用 / 分隔）和 MD5 的 MD5
+//
+// files 是相对路径到 MD5 的映射，如 DirScanResult.Files，内容相同的文件夹版本哈希相同
+func TreeMD5(files map[string]string) string {
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Slice(fileNames, func(i, j int) bool {
+		return filepath.ToSlash(fileNames[i]) < filepath.ToSlash(fileNames[j])
+	})
+	md5hash := md5.New()
+	for _, fileName := range fileNames {
+		fmt.Fprintf(md5hash, "%s\x00%s\n", filepath.ToSlash(fileName), files[fileName])
 	}
-	return md5List, err
+	return hex.EncodeToString(md5hash.Sum(nil))
 }
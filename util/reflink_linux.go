@@ -0,0 +1,31 @@
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone 是 ioctl FICLONE，即 _IOW(0x94, 9, int)
+const ficlone = 0x40049409
+
+// ReflinkFile 用 FICLONE 创建与 src 共享数据块的 dst，已经存在的 dst 会被覆盖，
+// 只有 btrfs、xfs 等文件系统支持，而且 src 和 dst 必须在同一个文件系统中
+func ReflinkFile(dst, src string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	defer RemoveOnError(dst, &err)
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd()); errno != 0 {
+		return &os.PathError{Op: "ioctl FICLONE", Path: dst, Err: errno}
+	}
+	return out.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package util
+
+import "errors"
+
+// ReflinkFile 只支持 Linux，其他系统上总是返回 errors.ErrUnsupported
+func ReflinkFile(dst, src string) error {
+	return errors.ErrUnsupported
+}
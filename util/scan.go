@@ -0,0 +1,199 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+type DirScanResult struct {
+	// Files 是普通文件相对路径到 MD5 的映射
+	Files map[string]string
+	// Symlinks 是符号链接相对路径到链接目标的映射，链接目标原样记录，可能是相对路径也可能是绝对路径
+	Symlinks map[string]string
+	// Dirs 是全部子文件夹的相对路径，包括空文件夹。设置了包含规则时只记录含有被包含文件的文件夹
+	Dirs map[string]bool
+}
+
+type ScanOptions struct {
+	// Ignore 为 nil 时扫描全部文件
+	Ignore *IgnoreRules
+	// Cache 为 nil 时每个文件都重新计算 MD5
+	Cache *HashCache
+	// Workers 是同时计算 MD5 的协程数量，小于等于 0 时使用 CPU 核数
+	Workers int
+}
+
+// ScanDir 遍历文件夹，计算全部普通文件的 MD5，并记录符号链接本身（不跟随链接）和全部子文件夹
+func ScanDir(ctx context.Context, dirAbsPath string, options *ScanOptions) (*DirScanResult, error) {
+	results, err := ScanDirs(ctx, []string{dirAbsPath}, options)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+type scanJob struct {
+	result  *DirScanResult
+	path    string
+	relPath string
+	info    os.FileInfo
+}
+
+// ScanDirs 同时遍历多个文件夹，全部文件夹共用 options.Workers 个计算 MD5 的协程
+//
+// 每个文件夹按遍历顺序把文件交给计算协程，同一文件夹中相邻的文件会被相邻地读取。ctx 取消后不再读取新的文件。
+func ScanDirs(ctx context.Context, dirAbsPaths []string, options *ScanOptions) ([]*DirScanResult, error) {
+	if options == nil {
+		options = &ScanOptions{}
+	}
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var mu sync.Mutex
+	var firstErr error
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	failed := func() bool {
+		if err := ctx.Err(); err != nil {
+			setErr(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	jobs := make(chan scanJob, workers*4)
+	var workersWg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+			for job := range jobs {
+				if failed() {
+					continue
+				}
+				var md5sum string
+				var err error
+				if options.Cache != nil {
+					md5sum, err = options.Cache.FileMD5(job.path, job.info)
+				} else {
+					md5sum, err = FileMD5(job.path)
+				}
+				if err != nil {
+					setErr(err)
+					continue
+				}
+				mu.Lock()
+				job.result.Files[job.relPath] = md5sum
+				mu.Unlock()
+			}
+		}()
+	}
+
+	results := make([]*DirScanResult, len(dirAbsPaths))
+	var walkersWg sync.WaitGroup
+	for i, dirAbsPath := range dirAbsPaths {
+		result := &DirScanResult{
+			Files:    make(map[string]string),
+			Symlinks: make(map[string]string),
+			Dirs:     make(map[string]bool),
+		}
+		results[i] = result
+		walkersWg.Add(1)
+		go func(dirAbsPath string) {
+			defer walkersWg.Done()
+			err := walkDir(dirAbsPath, options, result, jobs, failed)
+			if err != nil {
+				setErr(err)
+			}
+		}(dirAbsPath)
+	}
+	walkersWg.Wait()
+	close(jobs)
+	workersWg.Wait()
+
+	if firstErr != nil {
+		return nil, fmt.Errorf(i18n.T("遍历目录全部文件错误：%w"), firstErr)
+	}
+	return results, nil
+}
+
+func walkDir(dirAbsPath string, options *ScanOptions, result *DirScanResult, jobs chan<- scanJob, failed func() bool) error {
+	return filepath.Walk(dirAbsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if failed() {
+			return filepath.SkipDir
+		}
+		if path == dirAbsPath {
+			return nil
+		}
+		relPath, err := filepath.Rel(dirAbsPath, path)
+		if err != nil {
+			return fmt.Errorf(i18n.T("路径 %s 不在 %s 中：%w"), path, dirAbsPath, err)
+		}
+		if options.Ignore.Excluded(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf(i18n.T("读取符号链接 %s 错误：%w"), path, err)
+			}
+			result.Symlinks[relPath] = target
+			includeParentDirs(options, result, relPath)
+		} else if info.IsDir() {
+			if !options.Ignore.HasIncludes() {
+				result.Dirs[relPath] = true
+			}
+		} else if info.Mode().IsRegular() {
+			includeParentDirs(options, result, relPath)
+			jobs <- scanJob{result: result, path: path, relPath: relPath, info: info}
+		}
+		return nil
+	})
+}
+
+// includeParentDirs 在设置了包含规则时记录被包含文件的全部上级文件夹，避免补丁创建不含任何文件的空文件夹
+func includeParentDirs(options *ScanOptions, result *DirScanResult, relPath string) {
+	if !options.Ignore.HasIncludes() {
+		return
+	}
+	for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+		if result.Dirs[dir] {
+			return
+		}
+		result.Dirs[dir] = true
+	}
+}
+
+// SymlinkEscapesRoot 判断位于 rootAbsPath 下 linkRelPath 处、指向 target 的符号链接是否指向文件夹之外
+func SymlinkEscapesRoot(rootAbsPath, linkRelPath, target string) bool {
+	resolved := target
+	if !filepath.IsAbs(target) {
+		resolved = filepath.Join(rootAbsPath, filepath.Dir(linkRelPath), target)
+	}
+	relPath, err := filepath.Rel(rootAbsPath, resolved)
+	if err != nil {
+		return true
+	}
+	return relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 同时扫描的文件夹中有相同路径、不同内容的文件，每个文件夹的结果只包含自己的文件，与协程数量无关
+func TestScanDirsConcurrent(t *testing.T) {
+	root := t.TempDir()
+	dirs := []string{filepath.Join(root, "old"), filepath.Join(root, "new")}
+	want := make([]map[string]string, len(dirs))
+	for i, dir := range dirs {
+		want[i] = make(map[string]string)
+		for j := 0; j < 100; j++ {
+			relPath := filepath.Join(fmt.Sprintf("d%d", j%7), fmt.Sprintf("f%d.txt", j))
+			path := filepath.Join(dir, relPath)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(fmt.Sprintf("%s %d", filepath.Base(dir), j)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			md5sum, err := FileMD5(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want[i][relPath] = md5sum
+		}
+	}
+	for _, workers := range []int{1, 3, 16} {
+		results, err := ScanDirs(context.Background(), dirs, &ScanOptions{Workers: workers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, result := range results {
+			if !reflect.DeepEqual(result.Files, want[i]) {
+				t.Errorf("%d 个协程时 %s 的扫描结果不正确", workers, dirs[i])
+			}
+			if len(result.Dirs) != 7 {
+				t.Errorf("%d 个协程时 %s 有 %d 个文件夹，期望 7 个", workers, dirs[i], len(result.Dirs))
+			}
+		}
+	}
+}
+
+func TestScanDirsError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanDirs(context.Background(), []string{dir, filepath.Join(dir, "missing")}, nil); err == nil {
+		t.Error("文件夹不存在时应该返回错误")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ScanDirs(ctx, []string{dir, dir}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("ctx 取消后返回 %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ganlvtech/go-dir-bsdiff/i18n"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseSize 解析字节数，可以带单位，如 104857600、100MiB、1.5GiB、64M、500KB
+//
+// KiB、MiB、GiB、TiB 和 K、M、G、T 是 1024 进制，KB、MB、GB、TB 是 1000 进制，单位不区分大小写。
+func ParseSize(s string) (int64, error) {
+	text := strings.TrimSpace(s)
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if len(text) > len(unit.suffix) && strings.EqualFold(text[len(text)-len(unit.suffix):], unit.suffix) {
+			text = strings.TrimSpace(text[:len(text)-len(unit.suffix)])
+			multiplier = unit.size
+			break
+		}
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf(i18n.T("大小 %s 不能是负数"), s)
+		}
+		if multiplier > 1 && n > (1<<63-1)/multiplier {
+			return 0, fmt.Errorf(i18n.T("大小 %s 太大"), s)
+		}
+		return n * multiplier, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf(i18n.T("无法解析大小 %s"), s)
+	}
+	if f < 0 {
+		return 0, fmt.Errorf(i18n.T("大小 %s 不能是负数"), s)
+	}
+	if f*float64(multiplier) >= 1<<63 {
+		return 0, fmt.Errorf(i18n.T("大小 %s 太大"), s)
+	}
+	return int64(f * float64(multiplier)), nil
+}
+
+// FormatSize 把字节数格式化为便于阅读的形式，如 1.5 MiB，负数表示未知，返回 -
+func FormatSize(size int64) string {
+	if size < 0 {
+		return "-"
+	}
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	for _, unit := range []string{"KiB", "MiB", "GiB"} {
+		value /= 1024
+		if value < 1024 {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+	}
+	return fmt.Sprintf("%.1f TiB", value/1024)
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+var zeroBlock = make([]byte, 64*1024)
+
+// IsZero 判断数据是否全部为 0，空数据也返回 true
+func IsZero(b []byte) bool {
+	for len(b) > 0 {
+		n := min(len(b), len(zeroBlock))
+		if !bytes.Equal(b[:n], zeroBlock[:n]) {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
+
+// IsZeroFile 判断文件内容是否全部为 0，读到第一个不为 0 的字节就停止，同时返回文件大小
+func IsZeroFile(path string) (bool, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, CopyBufferSize)
+	size := int64(0)
+	for {
+		n, err := io.ReadFull(f, buf)
+		size += int64(n)
+		if !IsZero(buf[:n]) {
+			return false, size, nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return true, size, nil
+		} else if err != nil {
+			return false, size, err
+		}
+	}
+}
+
+// WriteZero 在文件当前位置之后留出 size 字节的空洞，不写入数据，文件系统支持时不占用磁盘空间
+//
+// 空洞在文件末尾时需要用 Truncate 把文件扩展到最终大小，见 TruncateAtOffset
+func WriteZero(f *os.File, size int64) error {
+	_, err := f.Seek(size, io.SeekCurrent)
+	return err
+}
+
+// TruncateAtOffset 把文件截断或扩展到当前位置
+func TruncateAtOffset(f *os.File) error {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return f.Truncate(offset)
+}